@@ -11,6 +11,7 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/types"
 	cfg "github.com/conductorone/baton-tailscale/pkg/config"
 	"github.com/conductorone/baton-tailscale/pkg/connector"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
 )
@@ -53,9 +54,31 @@ func getConnector(ctx context.Context, tsc *cfg.Tailscale) (types.ConnectorServe
 
 	cb, err := connector.New(
 		ctx,
-		tsc.ApiKey,
+		client.Credentials{
+			APIKey:            tsc.ApiKey,
+			OAuthClientID:     tsc.OauthClientId,
+			OAuthClientSecret: tsc.OauthClientSecret,
+		},
+		client.Credentials{
+			APIKey:            tsc.WriteApiKey,
+			OAuthClientID:     tsc.WriteOauthClientId,
+			OAuthClientSecret: tsc.WriteOauthClientSecret,
+		},
 		tsc.Tailnet,
-		tsc.IgnoreEphemeralDevices,
+		connector.DeviceFilter{
+			IgnoreEphemeral:        tsc.IgnoreEphemeralDevices,
+			IgnoreExternal:         tsc.IgnoreExternalDevices,
+			IncludeTags:            tsc.DeviceIncludeTags,
+			ExcludeTags:            tsc.DeviceExcludeTags,
+			IncludeOS:              tsc.DeviceIncludeOs,
+			ExcludeOS:              tsc.DeviceExcludeOs,
+			HostnamePattern:        tsc.DeviceHostnamePattern,
+			ExcludeHostnamePattern: tsc.DeviceExcludeHostnamePattern,
+			MaxLastSeenDays:        tsc.DeviceMaxLastSeenDays,
+		},
+		tsc.DisableSyncCache,
+		tsc.DryRun,
+		tsc.PolicyCacheDir,
 	)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
@@ -5,8 +5,24 @@ import "reflect"
 
 type Tailscale struct {
 	ApiKey string `mapstructure:"api-key"`
+	OauthClientId string `mapstructure:"oauth-client-id"`
+	OauthClientSecret string `mapstructure:"oauth-client-secret"`
+	WriteApiKey string `mapstructure:"write-api-key"`
+	WriteOauthClientId string `mapstructure:"write-oauth-client-id"`
+	WriteOauthClientSecret string `mapstructure:"write-oauth-client-secret"`
 	Tailnet string `mapstructure:"tailnet"`
 	IgnoreEphemeralDevices bool `mapstructure:"ignore-ephemeral-devices"`
+	IgnoreExternalDevices bool `mapstructure:"ignore-external-devices"`
+	DeviceIncludeTags []string `mapstructure:"device-include-tags"`
+	DeviceExcludeTags []string `mapstructure:"device-exclude-tags"`
+	DeviceIncludeOs []string `mapstructure:"device-include-os"`
+	DeviceExcludeOs []string `mapstructure:"device-exclude-os"`
+	DeviceHostnamePattern string `mapstructure:"device-hostname-pattern"`
+	DeviceExcludeHostnamePattern string `mapstructure:"device-exclude-hostname-pattern"`
+	DeviceMaxLastSeenDays int `mapstructure:"device-max-last-seen-days"`
+	DisableSyncCache bool `mapstructure:"disable-sync-cache"`
+	PolicyCacheDir string `mapstructure:"policy-cache-dir"`
+	DryRun bool `mapstructure:"dry-run"`
 }
 
 func (c* Tailscale) findFieldByTag(tagValue string) (any, bool) {
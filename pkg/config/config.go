@@ -16,7 +16,39 @@ var (
 		"api-key",
 		field.WithDisplayName("API Key"),
 		field.WithDescription("Tailscale API Key"),
-		field.WithRequired(true),
+		field.WithIsSecret(true),
+	)
+
+	OAuthClientIDField = field.StringField(
+		"oauth-client-id",
+		field.WithDisplayName("OAuth Client ID"),
+		field.WithDescription("Tailscale OAuth client ID, used instead of an API key"),
+	)
+
+	OAuthClientSecretField = field.StringField(
+		"oauth-client-secret",
+		field.WithDisplayName("OAuth Client Secret"),
+		field.WithDescription("Tailscale OAuth client secret, used instead of an API key"),
+		field.WithIsSecret(true),
+	)
+
+	WriteApiKeyField = field.StringField(
+		"write-api-key",
+		field.WithDisplayName("Write API Key"),
+		field.WithDescription("Tailscale API Key used for provisioning. Provisioning is disabled when no write credential is set"),
+		field.WithIsSecret(true),
+	)
+
+	WriteOAuthClientIDField = field.StringField(
+		"write-oauth-client-id",
+		field.WithDisplayName("Write OAuth Client ID"),
+		field.WithDescription("Tailscale OAuth client ID used for provisioning, used instead of a write API key"),
+	)
+
+	WriteOAuthClientSecretField = field.StringField(
+		"write-oauth-client-secret",
+		field.WithDisplayName("Write OAuth Client Secret"),
+		field.WithDescription("Tailscale OAuth client secret used for provisioning, used instead of a write API key"),
 		field.WithIsSecret(true),
 	)
 
@@ -26,15 +58,103 @@ var (
 		field.WithDescription("Skip ingesting devices with isEphemeral=true attribute"),
 	)
 
+	IgnoreExternalDevicesField = field.BoolField(
+		"ignore-external-devices",
+		field.WithDisplayName("Ignore External Devices"),
+		field.WithDescription("Skip ingesting devices shared into the tailnet from other tailnets"),
+	)
+
+	DeviceIncludeTagsField = field.StringSliceField(
+		"device-include-tags",
+		field.WithDisplayName("Device Include Tags"),
+		field.WithDescription("Only ingest devices that carry at least one of these tags"),
+	)
+
+	DeviceExcludeTagsField = field.StringSliceField(
+		"device-exclude-tags",
+		field.WithDisplayName("Device Exclude Tags"),
+		field.WithDescription("Skip ingesting devices that carry any of these tags"),
+	)
+
+	DeviceIncludeOSField = field.StringSliceField(
+		"device-include-os",
+		field.WithDisplayName("Device Include OS"),
+		field.WithDescription("Only ingest devices running one of these operating systems, e.g. linux, macOS, windows"),
+	)
+
+	DeviceExcludeOSField = field.StringSliceField(
+		"device-exclude-os",
+		field.WithDisplayName("Device Exclude OS"),
+		field.WithDescription("Skip ingesting devices running any of these operating systems"),
+	)
+
+	DeviceHostnamePatternField = field.StringField(
+		"device-hostname-pattern",
+		field.WithDisplayName("Device Hostname Pattern"),
+		field.WithDescription("Only ingest devices whose hostname matches this regular expression"),
+	)
+
+	DeviceExcludeHostnamePatternField = field.StringField(
+		"device-exclude-hostname-pattern",
+		field.WithDisplayName("Device Exclude Hostname Pattern"),
+		field.WithDescription("Skip ingesting devices whose hostname matches this regular expression"),
+	)
+
+	DeviceMaxLastSeenDaysField = field.IntField(
+		"device-max-last-seen-days",
+		field.WithDisplayName("Device Max Last Seen Days"),
+		field.WithDescription("Skip ingesting devices that have not been seen for more than this many days"),
+	)
+
+	DisableSyncCacheField = field.BoolField(
+		"disable-sync-cache",
+		field.WithDisplayName("Disable Sync Cache"),
+		field.WithDescription("Fetch the policy file, users and devices again for every resource instead of once per sync"),
+	)
+
+	PolicyCacheDirField = field.StringField(
+		"policy-cache-dir",
+		field.WithDisplayName("Policy Cache Directory"),
+		field.WithDescription("Directory the policy file and the resources listed from it are kept in between runs, nothing is kept if empty"),
+	)
+
+	DryRunField = field.BoolField(
+		"dry-run",
+		field.WithDisplayName("Dry Run"),
+		field.WithDescription("Log and return the changes provisioning would make instead of making them, also without a write credential"),
+	)
+
 	// ConfigurationFields defines the external configuration required for the connector to run.
 	ConfigurationFields = []field.SchemaField{
 		ApiKeyField,
+		OAuthClientIDField,
+		OAuthClientSecretField,
+		WriteApiKeyField,
+		WriteOAuthClientIDField,
+		WriteOAuthClientSecretField,
 		TailnetField,
 		IgnoreEphemeralDevicesField,
+		IgnoreExternalDevicesField,
+		DeviceIncludeTagsField,
+		DeviceExcludeTagsField,
+		DeviceIncludeOSField,
+		DeviceExcludeOSField,
+		DeviceHostnamePatternField,
+		DeviceExcludeHostnamePatternField,
+		DeviceMaxLastSeenDaysField,
+		DisableSyncCacheField,
+		PolicyCacheDirField,
+		DryRunField,
 	}
 
-	Configurations     = field.NewConfiguration(ConfigurationFields)
-	FieldRelationships = []field.SchemaFieldRelationship{}
+	Configurations     = field.NewConfiguration(ConfigurationFields, field.WithConstraints(FieldRelationships...))
+	FieldRelationships = []field.SchemaFieldRelationship{
+		field.FieldsAtLeastOneUsed(ApiKeyField, OAuthClientIDField),
+		field.FieldsMutuallyExclusive(ApiKeyField, OAuthClientIDField),
+		field.FieldsRequiredTogether(OAuthClientIDField, OAuthClientSecretField),
+		field.FieldsMutuallyExclusive(WriteApiKeyField, WriteOAuthClientIDField),
+		field.FieldsRequiredTogether(WriteOAuthClientIDField, WriteOAuthClientSecretField),
+	}
 )
 
 //go:generate go run ./gen
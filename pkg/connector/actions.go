@@ -0,0 +1,209 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	configV1 "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// actionResultTTL is how long the result of an action can be looked up
+// after it ran.
+const actionResultTTL = time.Hour
+
+// actionHandler runs a custom action with the arguments it was invoked with.
+type actionHandler func(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error)
+
+type action struct {
+	schema  *v2.BatonActionSchema
+	handler actionHandler
+}
+
+type actionResult struct {
+	name     string
+	status   v2.BatonActionStatus
+	response *structpb.Struct
+	expires  time.Time
+}
+
+// actionManager keeps the custom actions the resource builders register.
+// Actions run synchronously, so their status is final once InvokeAction
+// returns. Results are kept for actionResultTTL.
+type actionManager struct {
+	mtx     sync.Mutex
+	actions map[string]action
+	results map[string]actionResult
+	now     func() time.Time
+}
+
+func newActionManager() *actionManager {
+	return &actionManager{
+		actions: make(map[string]action),
+		results: make(map[string]actionResult),
+		now:     time.Now,
+	}
+}
+
+// pruneResults drops the results that expired. m.mtx must be held.
+func (m *actionManager) pruneResults() {
+	now := m.now()
+	for id, result := range m.results {
+		if now.After(result.expires) {
+			delete(m.results, id)
+		}
+	}
+}
+
+func (m *actionManager) register(schema *v2.BatonActionSchema, handler actionHandler) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.actions[schema.Name] = action{
+		schema:  schema,
+		handler: handler,
+	}
+}
+
+func (m *actionManager) ListActionSchemas(_ context.Context) ([]*v2.BatonActionSchema, annotations.Annotations, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	schemas := make([]*v2.BatonActionSchema, 0, len(m.actions))
+	for _, action := range m.actions {
+		schemas = append(schemas, action.schema)
+	}
+	slices.SortFunc(schemas, func(a, b *v2.BatonActionSchema) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return schemas, nil, nil
+}
+
+func (m *actionManager) GetActionSchema(_ context.Context, name string) (*v2.BatonActionSchema, annotations.Annotations, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	action, ok := m.actions[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("tailscale-connector: unknown action %s", name)
+	}
+	return action.schema, nil, nil
+}
+
+func (m *actionManager) InvokeAction(
+	ctx context.Context,
+	name string,
+	args *structpb.Struct,
+) (
+	string,
+	v2.BatonActionStatus,
+	*structpb.Struct,
+	annotations.Annotations,
+	error,
+) {
+	m.mtx.Lock()
+	action, ok := m.actions[name]
+	m.mtx.Unlock()
+	if !ok {
+		return "", v2.BatonActionStatus_BATON_ACTION_STATUS_UNKNOWN, nil, nil, fmt.Errorf("tailscale-connector: unknown action %s", name)
+	}
+
+	id := ksuid.New().String()
+	response, outputAnnotations, err := action.handler(ctx, args)
+	status := v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE
+	if err != nil {
+		status = v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED
+	}
+
+	m.mtx.Lock()
+	m.pruneResults()
+	m.results[id] = actionResult{
+		name:     name,
+		status:   status,
+		response: response,
+		expires:  m.now().Add(actionResultTTL),
+	}
+	m.mtx.Unlock()
+
+	if err != nil {
+		return id, status, nil, outputAnnotations, err
+	}
+	return id, status, response, outputAnnotations, nil
+}
+
+func (m *actionManager) GetActionStatus(
+	_ context.Context,
+	id string,
+) (
+	v2.BatonActionStatus,
+	string,
+	*structpb.Struct,
+	annotations.Annotations,
+	error,
+) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.pruneResults()
+	result, ok := m.results[id]
+	if !ok {
+		return v2.BatonActionStatus_BATON_ACTION_STATUS_UNKNOWN, "", nil, nil, fmt.Errorf("tailscale-connector: unknown action invocation %s", id)
+	}
+	return result.status, result.name, result.response, nil, nil
+}
+
+// stringActionField describes a string argument or return value of an action.
+func stringActionField(name string, displayName string, description string, required bool) *configV1.Field {
+	return &configV1.Field{
+		Name:        name,
+		DisplayName: displayName,
+		Description: description,
+		IsRequired:  required,
+		Field: &configV1.Field_StringField{
+			StringField: &configV1.StringField{},
+		},
+	}
+}
+
+// stringActionArgument reads a required string argument of an action.
+func stringActionArgument(args *structpb.Struct, name string) (string, error) {
+	value, ok := args.GetFields()[name]
+	if !ok || value.GetStringValue() == "" {
+		return "", fmt.Errorf("tailscale-connector: missing argument %s", name)
+	}
+	return value.GetStringValue(), nil
+}
+
+// boolActionField describes a boolean argument or return value of an action.
+func boolActionField(name string, displayName string, description string, required bool) *configV1.Field {
+	return &configV1.Field{
+		Name:        name,
+		DisplayName: displayName,
+		Description: description,
+		IsRequired:  required,
+		Field: &configV1.Field_BoolField{
+			BoolField: &configV1.BoolField{},
+		},
+	}
+}
+
+// boolActionArgument reads a required boolean argument of an action.
+func boolActionArgument(args *structpb.Struct, name string) (bool, error) {
+	value, ok := args.GetFields()[name]
+	if !ok {
+		return false, fmt.Errorf("tailscale-connector: missing argument %s", name)
+	}
+	boolValue, ok := value.GetKind().(*structpb.Value_BoolValue)
+	if !ok {
+		return false, fmt.Errorf("tailscale-connector: argument %s must be a boolean", name)
+	}
+	return boolValue.BoolValue, nil
+}
@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestActionManager(t *testing.T) {
+	ctx := context.Background()
+
+	manager := newActionManager()
+	manager.register(&v2.BatonActionSchema{Name: "echo"}, func(_ context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+		value, err := stringActionArgument(args, "value")
+		if err != nil {
+			return nil, nil, err
+		}
+		response, err := structpb.NewStruct(map[string]interface{}{"value": value})
+		return response, nil, err
+	})
+	manager.register(&v2.BatonActionSchema{Name: "broken"}, func(_ context.Context, _ *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+		return nil, nil, errors.New("broken")
+	})
+
+	schemas, _, err := manager.ListActionSchemas(ctx)
+	require.Nil(t, err)
+	require.Len(t, schemas, 2)
+	require.Equal(t, "broken", schemas[0].Name)
+
+	args, err := structpb.NewStruct(map[string]interface{}{"value": "hello"})
+	require.Nil(t, err)
+	id, status, response, _, err := manager.InvokeAction(ctx, "echo", args)
+	require.Nil(t, err)
+	require.Equal(t, v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE, status)
+	require.Equal(t, "hello", response.GetFields()["value"].GetStringValue())
+
+	status, name, _, _, err := manager.GetActionStatus(ctx, id)
+	require.Nil(t, err)
+	require.Equal(t, v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE, status)
+	require.Equal(t, "echo", name)
+
+	id, status, _, _, err = manager.InvokeAction(ctx, "broken", args)
+	require.NotNil(t, err)
+	require.Equal(t, v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, status)
+
+	status, _, _, _, err = manager.GetActionStatus(ctx, id)
+	require.Nil(t, err)
+	require.Equal(t, v2.BatonActionStatus_BATON_ACTION_STATUS_FAILED, status)
+
+	_, _, _, _, err = manager.InvokeAction(ctx, "echo", &structpb.Struct{})
+	require.NotNil(t, err)
+
+	_, _, err = manager.GetActionSchema(ctx, "missing")
+	require.NotNil(t, err)
+
+	// Results expire, so they do not pile up for the life of the process.
+	manager.now = func() time.Time { return time.Now().Add(actionResultTTL + time.Minute) }
+	_, _, _, _, err = manager.GetActionStatus(ctx, id)
+	require.NotNil(t, err)
+	require.Empty(t, manager.results)
+}
@@ -0,0 +1,174 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	resourceSDK "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+)
+
+// autogroup is a group that Tailscale maintains for every tailnet. Its
+// members are either the users with a role or the users of a type.
+// https://tailscale.com/kb/1337/acl-syntax#autogroups
+type autogroup struct {
+	name     string
+	role     string
+	userType string
+}
+
+var autogroups = []autogroup{
+	{name: "member", userType: "member"},
+	{name: "shared", userType: sharedUserType},
+	{name: "owner", role: "owner"},
+	{name: "admin", role: "admin"},
+	{name: "it-admin", role: "it-admin"},
+	{name: "network-admin", role: "network-admin"},
+	{name: "billing-admin", role: "billing-admin"},
+	{name: "auditor", role: "auditor"},
+}
+
+// autogroupAliases maps legacy autogroup names to their current name.
+var autogroupAliases = map[string]string{
+	"members": "member",
+}
+
+// findAutogroup looks up an autogroup by its policy file name,
+// e.g. `autogroup:it-admin`. Autogroups that do not stand for users, like
+// `autogroup:self` or `autogroup:nonroot`, are not found.
+func findAutogroup(policyName string) (autogroup, bool) {
+	name, ok := strings.CutPrefix(policyName, client.AutogroupPrefix)
+	if !ok {
+		return autogroup{}, false
+	}
+	if alias, ok := autogroupAliases[name]; ok {
+		name = alias
+	}
+
+	for _, group := range autogroups {
+		if group.name == name {
+			return group, true
+		}
+	}
+	return autogroup{}, false
+}
+
+func (a autogroup) id() string {
+	return client.AutogroupPrefix + a.name
+}
+
+type autogroupBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client.Client
+}
+
+func autogroupResource(group autogroup, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	return resourceSDK.NewGroupResource(
+		group.id(),
+		autogroupResourceType,
+		group.id(),
+		nil,
+		resourceSDK.WithParentResourceID(parentResourceID),
+	)
+}
+
+func (o *autogroupBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *autogroupBuilder) List(
+	_ context.Context,
+	parentID *v2.ResourceId,
+	_ *pagination.Token,
+) (
+	[]*v2.Resource,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	output := make([]*v2.Resource, 0)
+	for _, group := range autogroups {
+		newResource, err := autogroupResource(group, parentID)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		output = append(output, newResource)
+	}
+	return output, "", nil, nil
+}
+
+func (o *autogroupBuilder) Entitlements(
+	_ context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Entitlement,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	membership := entitlement.NewAssignmentEntitlement(
+		resource,
+		entitlementName,
+		entitlement.WithGrantableTo(userResourceType, roleResourceType),
+		entitlement.WithDisplayName(
+			fmt.Sprintf("%s Member", resource.DisplayName),
+		),
+		entitlement.WithDescription(
+			fmt.Sprintf("Is matched by %s in the Tailscale policy file", resource.DisplayName),
+		),
+	)
+
+	return []*v2.Entitlement{membership}, "", nil, nil
+}
+
+// Grants of role-based autogroups go to the role, and expand to the users
+// holding it. Type-based autogroups are granted to their users directly.
+func (o *autogroupBuilder) Grants(
+	ctx context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Grant,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	group, ok := findAutogroup(resource.Id.Resource)
+	if !ok {
+		return nil, "", nil, fmt.Errorf("tailscale-connector: unknown autogroup %s", resource.Id.Resource)
+	}
+
+	if group.role != "" {
+		grants := []*v2.Grant{
+			expandableGrant(resource, entitlementName, roleResourceType, group.role),
+		}
+		return grants, "", nil, nil
+	}
+
+	users, _, err := o.client.GetUsers(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var userIDs []string
+	for _, user := range users {
+		if user.Type == group.userType {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+
+	return userIDsToGrants(resource, userIDs), "", nil, nil
+}
+
+func newAutogroupBuilder(client *client.Client) *autogroupBuilder {
+	return &autogroupBuilder{
+		resourceType: autogroupResourceType,
+		client:       client,
+	}
+}
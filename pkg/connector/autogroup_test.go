@@ -0,0 +1,23 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAutogroup(t *testing.T) {
+	group, ok := findAutogroup("autogroup:it-admin")
+	require.True(t, ok)
+	require.Equal(t, "it-admin", group.role)
+
+	group, ok = findAutogroup("autogroup:members")
+	require.True(t, ok)
+	require.Equal(t, "autogroup:member", group.id())
+
+	_, ok = findAutogroup("autogroup:nonroot")
+	require.False(t, ok)
+
+	_, ok = findAutogroup("group:devs")
+	require.False(t, ok)
+}
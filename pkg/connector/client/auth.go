@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+// ErrReadOnly is returned by write calls when no write credential was configured.
+var ErrReadOnly = errors.New("tailscale-connector: no write credential configured, provisioning is disabled")
+
+const (
+	apiPathOAuthToken = "/oauth/token"
+	// tokenExpiryLeeway is how long before the reported expiry an OAuth access
+	// token is considered stale and gets refreshed.
+	tokenExpiryLeeway = 5 * time.Minute
+)
+
+// Credentials configures how the client authenticates against the Tailscale API.
+// Either APIKey or both OAuthClientID and OAuthClientSecret must be set.
+type Credentials struct {
+	APIKey            string
+	OAuthClientID     string
+	OAuthClientSecret string
+}
+
+// IsZero reports whether no credential was configured.
+func (c Credentials) IsZero() bool {
+	return c.APIKey == "" && c.OAuthClientID == "" && c.OAuthClientSecret == ""
+}
+
+// tokenSource supplies the access token sent with every API request.
+type tokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+func newTokenSource(credentials Credentials, wrapper *uhttp.BaseHttpClient) (tokenSource, error) {
+	if credentials.OAuthClientID != "" || credentials.OAuthClientSecret != "" {
+		if credentials.OAuthClientID == "" || credentials.OAuthClientSecret == "" {
+			return nil, errors.New("tailscale-connector: oauth client id and secret must be set together")
+		}
+
+		tokenUrl, err := url.Parse(baseUrl + apiPathOAuthToken)
+		if err != nil {
+			return nil, fmt.Errorf("tailscale-connector: error parsing oauth token url: %w", err)
+		}
+
+		return &oauthTokenSource{
+			clientID:     credentials.OAuthClientID,
+			clientSecret: credentials.OAuthClientSecret,
+			tokenUrl:     tokenUrl,
+			wrapper:      wrapper,
+			now:          time.Now,
+		}, nil
+	}
+
+	if credentials.APIKey == "" {
+		return nil, errors.New("tailscale-connector: either an api key or oauth client credentials are required")
+	}
+
+	return apiKeyTokenSource(credentials.APIKey), nil
+}
+
+// apiKeyTokenSource uses a static API access token.
+type apiKeyTokenSource string
+
+func (s apiKeyTokenSource) Token(_ context.Context) (string, error) {
+	return string(s), nil
+}
+
+// keyID returns the ID embedded in an API access token,
+// which has the form tskey-api-<id>-<secret>.
+func (s apiKeyTokenSource) keyID() string {
+	parts := strings.SplitN(string(s), "-", 4)
+	if len(parts) != 4 || parts[0] != "tskey" {
+		return ""
+	}
+	return parts[2]
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthTokenSource exchanges OAuth client credentials for short-lived access
+// tokens. Tokens are cached and refreshed shortly before they expire.
+// https://tailscale.com/kb/1215/oauth-clients
+type oauthTokenSource struct {
+	clientID     string
+	clientSecret string
+	tokenUrl     *url.URL
+	wrapper      *uhttp.BaseHttpClient
+	now          func() time.Time
+
+	mtx         sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func (s *oauthTokenSource) Token(ctx context.Context) (string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.accessToken != "" && s.now().Add(tokenExpiryLeeway).Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("client_id", s.clientID)
+	form.Set("client_secret", s.clientSecret)
+
+	request, err := s.wrapper.NewRequest(
+		ctx,
+		http.MethodPost,
+		s.tokenUrl,
+		uhttp.WithAcceptJSONHeader(),
+		uhttp.WithFormBody(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var target oauthTokenResponse
+	response, err := s.wrapper.Do(
+		request,
+		uhttp.WithJSONResponse(&target),
+	)
+	if err != nil {
+		return "", fmt.Errorf("tailscale-connector: error exchanging oauth client credentials: %w", err)
+	}
+	defer response.Body.Close()
+
+	if target.AccessToken == "" {
+		return "", errors.New("tailscale-connector: oauth token response did not include an access token")
+	}
+
+	s.accessToken = target.AccessToken
+	s.expiresAt = s.now().Add(time.Duration(target.ExpiresIn) * time.Second)
+
+	return s.accessToken, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	serverUrl, err := url.Parse(server.URL)
+	require.Nil(t, err)
+
+	wrapper, err := uhttp.NewBaseHttpClientWithContext(context.Background(), server.Client())
+	require.Nil(t, err)
+
+	return &Client{
+		readTokens:  apiKeyTokenSource("read"),
+		writeTokens: apiKeyTokenSource("write"),
+		tailnet:     "example.com",
+		baseUrl:     serverUrl,
+		wrapper:     wrapper,
+	}
+}
+
+func TestDeviceTags(t *testing.T) {
+	ctx := context.Background()
+
+	tags := []string{"tag:prod", "tag:server"}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			assert.Equal(t, "/device/12345", r.URL.Path)
+			assert.Equal(t, "Bearer read", r.Header.Get("Authorization"))
+			w.Header().Set("Content-Type", "application/json")
+			assert.Nil(t, json.NewEncoder(w).Encode(Device{ID: "12345", Tags: tags}))
+		case http.MethodPost:
+			assert.Equal(t, "/device/12345/tags", r.URL.Path)
+			assert.Equal(t, "Bearer write", r.Header.Get("Authorization"))
+			var body struct {
+				Tags []string `json:"tags"`
+			}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			tags = body.Tags
+		}
+	}))
+
+	wasAdded, _, err := c.AddTagToDevice(ctx, "12345", "tag:ci")
+	require.Nil(t, err)
+	require.True(t, wasAdded)
+	require.Equal(t, []string{"tag:prod", "tag:server", "tag:ci"}, tags)
+
+	wasAdded, _, err = c.AddTagToDevice(ctx, "12345", "tag:prod")
+	require.Nil(t, err)
+	require.False(t, wasAdded)
+
+	wasRemoved, _, err := c.RemoveTagFromDevice(ctx, "12345", "tag:server")
+	require.Nil(t, err)
+	require.True(t, wasRemoved)
+	require.Equal(t, []string{"tag:prod", "tag:ci"}, tags)
+
+	wasRemoved, _, err = c.RemoveTagFromDevice(ctx, "12345", "tag:server")
+	require.Nil(t, err)
+	require.False(t, wasRemoved)
+}
+
+func TestSetDeviceAuthorized(t *testing.T) {
+	ctx := context.Background()
+
+	var authorized *bool
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/device/12345/authorized", r.URL.Path)
+
+		var body struct {
+			Authorized *bool `json:"authorized"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		authorized = body.Authorized
+	}))
+
+	_, err := c.SetDeviceAuthorized(ctx, "12345", false)
+	require.Nil(t, err)
+	require.NotNil(t, authorized)
+	require.False(t, *authorized)
+
+	_, err = c.SetDeviceAuthorized(ctx, "12345", true)
+	require.Nil(t, err)
+	require.True(t, *authorized)
+}
+
+func TestDeviceKeyActions(t *testing.T) {
+	ctx := context.Background()
+
+	var requests []string
+	var keyExpiryDisabled *bool
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer write", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		if r.URL.Path == "/device/12345/key" {
+			var body struct {
+				KeyExpiryDisabled *bool `json:"keyExpiryDisabled"`
+			}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			keyExpiryDisabled = body.KeyExpiryDisabled
+		}
+	}))
+
+	_, err := c.ExpireDeviceKey(ctx, "12345")
+	require.Nil(t, err)
+
+	_, err = c.SetDeviceKeyExpiryDisabled(ctx, "12345", true)
+	require.Nil(t, err)
+	require.NotNil(t, keyExpiryDisabled)
+	require.True(t, *keyExpiryDisabled)
+
+	_, err = c.DeleteDevice(ctx, "12345")
+	require.Nil(t, err)
+
+	require.Equal(t, []string{
+		"POST /device/12345/expire",
+		"POST /device/12345/key",
+		"DELETE /device/12345",
+	}, requests)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/pmezard/go-difflib/difflib"
+	"go.uber.org/zap"
+)
+
+// dryRunPolicyWrites reports what every write would change in the policy
+// file without writing it. Since nothing is written, each write is applied
+// and validated against the current policy file on its own.
+func (c *Client) dryRunPolicyWrites(ctx context.Context, writes []*policyWrite) {
+	logger := ctxzap.Extract(ctx)
+	policy, _, ratelimitData, err := c.getForUpdate(ctx)
+	if err != nil {
+		for _, write := range writes {
+			write.ratelimitData = ratelimitData
+			write.err = err
+		}
+		return
+	}
+
+	current := policy.Pack()
+	for _, write := range writes {
+		write.ratelimitData = ratelimitData
+
+		candidate := policy.Clone()
+		if !applyPolicyWrites(ctx, &candidate, []*policyWrite{write}) {
+			continue
+		}
+		candidate.Format()
+		proposed := candidate.Pack()
+
+		validation, ratelimitData, err := c.ValidatePolicy(ctx, proposed)
+		if err != nil {
+			failPolicyWrites([]*policyWrite{write}, ratelimitData, err)
+			continue
+		}
+		write.validation = validation
+		if validation.Failed() {
+			failPolicyWrites([]*policyWrite{write}, ratelimitData, &PolicyValidationError{Validation: validation})
+			continue
+		}
+
+		write.diff, err = policyDiff(current, proposed)
+		if err != nil {
+			failPolicyWrites([]*policyWrite{write}, ratelimitData, err)
+			continue
+		}
+		logger.Info(
+			"tailscale-connector: dry run, not writing policy file",
+			zap.String("diff", write.diff),
+		)
+	}
+}
+
+// policyDiff returns the unified diff between the current and the proposed
+// policy file.
+func policyDiff(current []byte, proposed []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(current)),
+		B:        difflib.SplitLines(string(proposed)),
+		FromFile: "policy.hujson (current)",
+		ToFile:   "policy.hujson (proposed)",
+		Context:  3,
+	})
+}
+
+// DryRunRequest is a write request that was logged instead of sent in
+// dry-run mode.
+type DryRunRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// DryRunError is returned in dry-run mode by writes whose result only
+// exists once the request is sent, like the invite sent to a new user.
+type DryRunError struct {
+	Request *DryRunRequest
+}
+
+func (e *DryRunError) Error() string {
+	return fmt.Sprintf("tailscale-connector: dry run, %s %s was not sent", e.Request.Method, e.Request.URL)
+}
+
+// logDryRunRequest logs a write request that is not sent in dry-run mode.
+func logDryRunRequest(ctx context.Context, method string, uri *url.URL, body interface{}) (*DryRunRequest, error) {
+	request := &DryRunRequest{
+		Method: method,
+		URL:    uri.String(),
+	}
+	fields := []zap.Field{
+		zap.String("method", request.Method),
+		zap.String("url", request.URL),
+	}
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		request.Body = bodyJSON
+		fields = append(fields, zap.String("body", string(bodyJSON)))
+	}
+
+	ctxzap.Extract(ctx).Info("tailscale-connector: dry run, not sending request", fields...)
+	return request, nil
+}
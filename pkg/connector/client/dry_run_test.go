@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunPolicyWrite(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tailnet/example.com/acl/validate":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+		case "/tailnet/example.com/acl":
+			assert.Equal(t, http.MethodGet, r.Method)
+			w.Header().Set("Content-Type", "application/hujson")
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("{\n\t\"groups\": {\n\t\t\"group:eng\": [\"alice@example.com\"]\n\t}\n}\n"))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	c.dryRun = true
+
+	result, _, err := c.AddEmailToGroup(ctx, "group:eng", "bob@example.com")
+	require.Nil(t, err)
+	require.True(t, result.Changed)
+	require.Contains(t, result.Diff, "--- policy.hujson (current)")
+	require.Contains(t, result.Diff, "+++ policy.hujson (proposed)")
+	require.Contains(t, result.Diff, `-		"group:eng": ["alice@example.com"]`)
+	require.Contains(t, result.Diff, `+		"group:eng": ["alice@example.com", "bob@example.com"]`)
+
+	result, _, err = c.AddEmailToGroup(ctx, "group:eng", "alice@example.com")
+	require.Nil(t, err)
+	require.False(t, result.Changed)
+	require.Empty(t, result.Diff)
+}
+
+func TestDryRunRequests(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	c.dryRun = true
+
+	user, _, err := c.UpdateUserRole(ctx, "u1", "admin")
+	require.Nil(t, err)
+	require.Equal(t, &User{ID: "u1", Role: "admin"}, user)
+
+	user, _, err = c.SuspendUser(ctx, "u1")
+	require.Nil(t, err)
+	require.Equal(t, &User{ID: "u1", Status: "suspended"}, user)
+
+	// Invites do not exist until they are sent, so none is made up.
+	invite, _, err := c.CreateUserInvite(ctx, "new@example.com", "member")
+	require.Nil(t, invite)
+	var dryRunErr *DryRunError
+	require.ErrorAs(t, err, &dryRunErr)
+	require.Equal(t, http.MethodPost, dryRunErr.Request.Method)
+	require.Contains(t, dryRunErr.Request.URL, "/tailnet/example.com/user-invites")
+	require.JSONEq(t, `[{"email": "new@example.com", "role": "member"}]`, string(dryRunErr.Request.Body))
+
+	pending := &UserInvite{ID: "i1", Email: "pending@example.com", Role: "member"}
+	invite, _, err = c.ReissueUserInvite(ctx, pending, "admin")
+	require.Nil(t, err)
+	require.Same(t, pending, invite)
+
+	_, err = c.SetDeviceKeyExpiryDisabled(ctx, "d1", true)
+	require.Nil(t, err)
+
+	_, err = c.DeleteDevice(ctx, "d1")
+	require.Nil(t, err)
+}
+
+func TestDryRunWithoutWriteCredential(t *testing.T) {
+	ctx := context.Background()
+
+	var authorization []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/tailnet/example.com/acl/validate":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+		case "/tailnet/example.com/acl":
+			assert.Equal(t, http.MethodGet, r.Method)
+			w.Header().Set("Content-Type", "application/hujson")
+			_, _ = w.Write([]byte(`{"groups": {"group:eng": ["alice@example.com"]}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	c.writeTokens = nil
+	require.False(t, c.CanWrite())
+	c.dryRun = true
+	require.True(t, c.CanWrite())
+
+	result, _, err := c.AddEmailToGroup(ctx, "group:eng", "bob@example.com")
+	require.Nil(t, err)
+	require.True(t, result.Changed)
+	require.NotEmpty(t, result.Diff)
+	require.Equal(t, []string{"Bearer read", "Bearer read"}, authorization)
+
+	_, err = c.DeleteDevice(ctx, "d1")
+	require.Nil(t, err)
+}
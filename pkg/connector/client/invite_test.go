@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUserInvite(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/tailnet/example.com/user-invites", r.URL.Path)
+		assert.Equal(t, "Bearer write", r.Header.Get("Authorization"))
+
+		var body []map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []map[string]string{{"email": "new.hire@example.com", "role": "admin"}}, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id": "29214", "role": "admin", "email": "new.hire@example.com", "inviteUrl": "https://login.tailscale.com/uinv/abc"}]`))
+	}))
+
+	userInvite, _, err := c.CreateUserInvite(ctx, "new.hire@example.com", "admin")
+	require.Nil(t, err)
+	require.Equal(t, "29214", userInvite.ID)
+	require.Equal(t, "admin", userInvite.Role)
+	require.Equal(t, "https://login.tailscale.com/uinv/abc", userInvite.InviteURL)
+}
+
+func TestDeleteAndResendUserInvite(t *testing.T) {
+	ctx := context.Background()
+
+	var requests []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer write", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+
+	_, err := c.DeleteUserInvite(ctx, "29214")
+	require.Nil(t, err)
+
+	_, err = c.ResendUserInvite(ctx, "29214")
+	require.Nil(t, err)
+
+	require.Equal(t, []string{
+		"DELETE /user-invites/29214",
+		"POST /user-invites/29214/resend",
+	}, requests)
+}
+
+func TestReissueUserInvite(t *testing.T) {
+	ctx := context.Background()
+
+	var requests []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPost {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id": "29215", "role": "admin", "email": "new.hire@example.com"}]`))
+		}
+	}))
+
+	newInvite, _, err := c.ReissueUserInvite(ctx, &UserInvite{ID: "29214", Role: "member", Email: "new.hire@example.com"}, "admin")
+	require.Nil(t, err)
+	require.Equal(t, "29215", newInvite.ID)
+
+	// The new invite is sent before the old one is cancelled.
+	require.Equal(t, []string{
+		"POST /tailnet/example.com/user-invites",
+		"DELETE /user-invites/29214",
+	}, requests)
+}
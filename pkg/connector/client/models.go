@@ -36,9 +36,12 @@ type DevicesAPIData struct {
 
 type Device struct {
 	Addresses                 []string  `json:"addresses,omitempty"`
+	AdvertisedRoutes          []string  `json:"advertisedRoutes,omitempty"`
 	Authorized                bool      `json:"authorized,omitempty"`
 	BlocksIncomingConnections bool      `json:"blocksIncomingConnections,omitempty"`
 	ClientVersion             string    `json:"clientVersion,omitempty"`
+	ConnectedToControl        bool      `json:"connectedToControl,omitempty"`
+	EnabledRoutes             []string  `json:"enabledRoutes,omitempty"`
 	Created                   time.Time `json:"created,omitempty"`
 	Expires                   time.Time `json:"expires,omitempty"`
 	Hostname                  string    `json:"hostname,omitempty"`
@@ -56,9 +59,12 @@ type Device struct {
 	UpdateAvailable           bool      `json:"updateAvailable,omitempty"`
 	User                      string    `json:"user,omitempty"`
 	IsEphemeral               bool      `json:"isEphemeral,omitempty"`
+	Tags                      []string  `json:"tags,omitempty"`
 }
 
-type UserInvitesAPIData []struct {
+type UserInvitesAPIData []UserInvite
+
+type UserInvite struct {
 	ID              string    `json:"id,omitempty"`
 	Role            string    `json:"role,omitempty"`
 	TailnetID       int64     `json:"tailnetId,omitempty"`
@@ -67,3 +73,10 @@ type UserInvitesAPIData []struct {
 	LastEmailSentAt time.Time `json:"lastEmailSentAt,omitempty"`
 	InviteURL       string    `json:"inviteUrl,omitempty"`
 }
+
+type Key struct {
+	ID          string    `json:"id,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Created     time.Time `json:"created,omitempty"`
+	Expires     time.Time `json:"expires,omitempty"`
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxPolicyWriteAttempts bounds how often a policy file write is retried
+	// when the policy file changed between reading and writing it.
+	maxPolicyWriteAttempts = 5
+	policyWriteBackoff     = 250 * time.Millisecond
+	// policyBatchWindow is how long a batch that already has several writes
+	// waits for more writes to commit together with.
+	policyBatchWindow = 100 * time.Millisecond
+)
+
+var errPreconditionFailed = errors.New("error updating tailscale grants: precondition failed")
+
+// policyMutation changes the policy file in place and reports whether it
+// changed anything. It must be safe to apply again to a newer policy file.
+type policyMutation func(ctx context.Context, policy *hujson.Value) (bool, error)
+
+// PolicyWriteResult is the outcome of a policy file edit.
+type PolicyWriteResult struct {
+	// Changed reports whether the edit changed the policy file. It is false
+	// when the policy file already was as requested.
+	Changed bool
+	// Validation is the output of validating the policy file the edit was
+	// committed with.
+	Validation *PolicyValidation
+	// Diff is the unified diff the edit would have made to the policy file.
+	// It is only set in dry-run mode, where the edit is not committed.
+	Diff string
+}
+
+// policyWrite is one queued mutation and, once committed, its result.
+type policyWrite struct {
+	mutate policyMutation
+	done   chan struct{}
+
+	changed       bool
+	validation    *PolicyValidation
+	diff          string
+	ratelimitData *v2.RateLimitDescription
+	err           error
+}
+
+// policyBatch queues the policy file writes that arrive while another
+// commit is in progress, so that they are committed with a single read and
+// write of the policy file. Every policy file write triggers an ACL reload
+// of the tailnet and an audit log entry.
+type policyBatch struct {
+	mtx     sync.Mutex
+	pending []*policyWrite
+	// collecting is set while the first write of a batch waits to commit it.
+	collecting bool
+}
+
+// add queues a write and reports whether it is the first of its batch,
+// which commits the batch.
+func (b *policyBatch) add(write *policyWrite) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.pending = append(b.pending, write)
+	if b.collecting {
+		return false
+	}
+	b.collecting = true
+	return true
+}
+
+func (b *policyBatch) size() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return len(b.pending)
+}
+
+func (b *policyBatch) take() []*policyWrite {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	writes := b.pending
+	b.pending = nil
+	b.collecting = false
+	return writes
+}
+
+// mutatePolicy applies mutate to the policy file. The write is batched with
+// concurrent writes; its result only reflects its own mutation.
+func (c *Client) mutatePolicy(ctx context.Context, mutate policyMutation) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	write := &policyWrite{
+		mutate: mutate,
+		done:   make(chan struct{}),
+	}
+
+	if c.batch.add(write) {
+		// The batch carries the writes of other callers, so it is committed
+		// even if this caller gives up.
+		c.commitPolicy(context.WithoutCancel(ctx))
+	}
+
+	// A write that was committed reports its result, even if ctx was done
+	// meanwhile.
+	select {
+	case <-write.done:
+		return write.result()
+	default:
+	}
+
+	select {
+	case <-write.done:
+		return write.result()
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (w *policyWrite) result() (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	if w.err != nil {
+		return nil, w.ratelimitData, w.err
+	}
+	return &PolicyWriteResult{
+		Changed:    w.changed,
+		Validation: w.validation,
+		Diff:       w.diff,
+	}, w.ratelimitData, nil
+}
+
+// commitPolicy commits the queued writes. Commits are serialized so they do
+// not conflict with each other; the writes queued while waiting for another
+// commit are committed together. A write on its own is committed right away,
+// a batch that already has several writes waits policyBatchWindow for more.
+func (c *Client) commitPolicy(ctx context.Context) {
+	c.policyWriteMtx.Lock()
+	defer c.policyWriteMtx.Unlock()
+
+	if c.batch.size() > 1 {
+		time.Sleep(policyBatchWindow)
+	}
+	writes := c.batch.take()
+
+	defer func() {
+		for _, write := range writes {
+			close(write.done)
+		}
+	}()
+
+	if c.dryRun {
+		c.dryRunPolicyWrites(ctx, writes)
+		return
+	}
+	c.commitPolicyWrites(ctx, writes)
+}
+
+// commitPolicyWrites reads the policy file, applies the writes, validates
+// the result and writes it back, conditional on the policy file not having
+// changed in between. When it did change, e.g. because someone edited it in
+// the admin console, the writes are applied again to the new policy file
+// after a jittered backoff. When the result fails validation, the writes of
+// a batch are committed one by one so that only the offending ones fail.
+func (c *Client) commitPolicyWrites(ctx context.Context, writes []*policyWrite) {
+	logger := ctxzap.Extract(ctx)
+	for attempt := 1; ; attempt++ {
+		response, etag, ratelimitData, err := c.getForUpdate(ctx)
+		if err != nil {
+			for _, write := range writes {
+				write.ratelimitData = ratelimitData
+				write.err = err
+			}
+			return
+		}
+
+		changed := applyPolicyWrites(ctx, response, writes)
+		if !changed {
+			return
+		}
+
+		response.Format()
+		// hujson payload bytes
+		postBody := response.Pack()
+
+		validation, ratelimitData, err := c.ValidatePolicy(ctx, postBody)
+		if err != nil {
+			failPolicyWrites(writes, ratelimitData, err)
+			return
+		}
+		if validation.Failed() {
+			if countChangedWrites(writes) > 1 {
+				for _, write := range writes {
+					c.commitPolicyWrites(ctx, []*policyWrite{write})
+				}
+				return
+			}
+
+			logger.Warn(
+				"tailscale-connector: policy file edit failed validation",
+				zap.String("message", validation.Message),
+			)
+			for _, write := range writes {
+				write.validation = validation
+			}
+			failPolicyWrites(writes, ratelimitData, &PolicyValidationError{Validation: validation})
+			return
+		}
+		for _, write := range writes {
+			if write.changed {
+				write.validation = validation
+			}
+		}
+
+		_, ratelimitData, err = c.post(ctx, postBody, etag)
+		if err == nil {
+			for _, write := range writes {
+				write.ratelimitData = ratelimitData
+			}
+			return
+		}
+		if !errors.Is(err, errPreconditionFailed) {
+			failPolicyWrites(writes, ratelimitData, err)
+			return
+		}
+		if attempt >= maxPolicyWriteAttempts {
+			err = fmt.Errorf("tailscale-connector: policy file kept changing, gave up after %d attempts: %w", attempt, err)
+			failPolicyWrites(writes, ratelimitData, err)
+			return
+		}
+
+		backoff := policyWriteBackoff << (attempt - 1)
+		backoff = backoff/2 + rand.N(backoff/2)
+		logger.Info(
+			"tailscale-connector: policy file changed while writing it, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("writes", len(writes)),
+			zap.Duration("backoff", backoff),
+		)
+		time.Sleep(backoff)
+	}
+}
+
+// applyPolicyWrites applies every write to the policy file and records its
+// own result. A write that fails leaves the policy file as it was, so it
+// does not affect the other writes of the batch.
+func applyPolicyWrites(ctx context.Context, policy *hujson.Value, writes []*policyWrite) bool {
+	changed := false
+	for _, write := range writes {
+		candidate := policy.Clone()
+		write.changed, write.err = write.mutate(ctx, &candidate)
+		if write.err != nil {
+			write.changed = false
+			continue
+		}
+		if write.changed {
+			*policy = candidate
+			changed = true
+		}
+	}
+	return changed
+}
+
+func countChangedWrites(writes []*policyWrite) int {
+	changed := 0
+	for _, write := range writes {
+		if write.changed {
+			changed++
+		}
+	}
+	return changed
+}
+
+// failPolicyWrites fails the writes whose changes could not be committed.
+// Writes that failed on their own or did not change anything keep their
+// result.
+func failPolicyWrites(writes []*policyWrite, ratelimitData *v2.RateLimitDescription, err error) {
+	for _, write := range writes {
+		write.ratelimitData = ratelimitData
+		if write.changed {
+			write.changed = false
+			write.err = err
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutatePolicyRetriesOnConflict(t *testing.T) {
+	ctx := context.Background()
+
+	version := 1
+	members := `"alice@example.com"`
+	conflicts := 1
+	var ifMatch []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tailnet/example.com/acl/validate" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/hujson")
+			w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, version))
+			_, _ = fmt.Fprintf(w, `{"groups": {"group:eng": [%s]}}`, members)
+		case http.MethodPost:
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			if conflicts > 0 {
+				// Someone else edits the policy file in the meantime.
+				conflicts--
+				version++
+				members = `"alice@example.com", "carol@example.com"`
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.Contains(t, string(body), "carol@example.com")
+			assert.Contains(t, string(body), "bob@example.com")
+			w.Header().Set("Content-Type", "application/hujson")
+			_, _ = w.Write(body)
+		}
+	}))
+
+	result, _, err := c.AddEmailToGroup(ctx, "group:eng", "bob@example.com")
+	require.Nil(t, err)
+	require.True(t, result.Changed)
+	require.Equal(t, []string{`"v1"`, `"v2"`}, ifMatch)
+}
+
+func TestMutatePolicyBatchesConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+
+	posts := 0
+	var c *Client
+	var firstCommit sync.Once
+	committing := make(chan struct{})
+	c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tailnet/example.com/acl/validate" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/hujson")
+		switch r.Method {
+		case http.MethodGet:
+			// The writes queued while the first one commits are batched.
+			firstCommit.Do(func() {
+				close(committing)
+				waitForQueuedWrites(c, 3)
+			})
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(`{"groups": {"group:eng": ["alice@example.com"], "group:ops": []}}`))
+		case http.MethodPost:
+			posts++
+			body, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.Contains(t, string(body), "bob@example.com")
+			assert.Contains(t, string(body), "carol@example.com")
+			_, _ = w.Write(body)
+		}
+	}))
+
+	type result struct {
+		changed bool
+		err     error
+	}
+	var mtx sync.Mutex
+	results := make(map[string]result)
+	var wg sync.WaitGroup
+
+	// A write that changes nothing commits first, on its own.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writeResult, _, err := c.AddEmailToGroup(ctx, "group:eng", "alice@example.com")
+		mtx.Lock()
+		results["add alice again"] = result{changed: writeResult != nil && writeResult.Changed, err: err}
+		mtx.Unlock()
+	}()
+	<-committing
+
+	writes := map[string]func() (*PolicyWriteResult, *v2.RateLimitDescription, error){
+		"add bob": func() (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+			return c.AddEmailToGroup(ctx, "group:eng", "bob@example.com")
+		},
+		"add carol": func() (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+			return c.AddEmailToGroup(ctx, "group:ops", "carol@example.com")
+		},
+		"add to missing group": func() (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+			return c.AddEmailToGroup(ctx, "group:missing", "dave@example.com")
+		},
+	}
+	for name, write := range writes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writeResult, _, err := write()
+			mtx.Lock()
+			results[name] = result{changed: writeResult != nil && writeResult.Changed, err: err}
+			mtx.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, posts)
+	require.Equal(t, result{changed: true}, results["add bob"])
+	require.Equal(t, result{changed: true}, results["add carol"])
+	require.Equal(t, result{changed: false}, results["add alice again"])
+	require.False(t, results["add to missing group"].changed)
+	require.NotNil(t, results["add to missing group"].err)
+}
+
+func TestMutatePolicyFailsValidation(t *testing.T) {
+	ctx := context.Background()
+
+	posts := 0
+	var c *Client
+	var firstCommit sync.Once
+	committing := make(chan struct{})
+	c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tailnet/example.com/acl/validate":
+			body, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			w.Header().Set("Content-Type", "application/json")
+			if strings.Contains(string(body), "mallory@example.com") {
+				_, _ = w.Write([]byte(`{"message": "test(s) failed", "data": [{"user": "mallory@example.com", "errors": ["mallory@example.com cannot access tag:prod:22"]}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		case "/tailnet/example.com/acl":
+			w.Header().Set("Content-Type", "application/hujson")
+			switch r.Method {
+			case http.MethodGet:
+				firstCommit.Do(func() {
+					close(committing)
+					waitForQueuedWrites(c, 2)
+				})
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = w.Write([]byte(`{"groups": {"group:eng": ["alice@example.com"]}}`))
+			case http.MethodPost:
+				posts++
+				body, err := io.ReadAll(r.Body)
+				assert.Nil(t, err)
+				assert.NotContains(t, string(body), "mallory@example.com")
+				_, _ = w.Write(body)
+			}
+		}
+	}))
+
+	var wg sync.WaitGroup
+	var bobResult *PolicyWriteResult
+	var bobErr, malloryErr error
+	wg.Add(3)
+	// A write that changes nothing commits first, so that bob and mallory
+	// are batched.
+	go func() {
+		defer wg.Done()
+		_, _, err := c.AddEmailToGroup(ctx, "group:eng", "alice@example.com")
+		assert.Nil(t, err)
+	}()
+	<-committing
+	go func() {
+		defer wg.Done()
+		bobResult, _, bobErr = c.AddEmailToGroup(ctx, "group:eng", "bob@example.com")
+	}()
+	go func() {
+		defer wg.Done()
+		_, _, malloryErr = c.AddEmailToGroup(ctx, "group:eng", "mallory@example.com")
+	}()
+	wg.Wait()
+
+	require.Nil(t, bobErr)
+	require.True(t, bobResult.Changed)
+	require.NotNil(t, bobResult.Validation)
+	require.False(t, bobResult.Validation.Failed())
+
+	var validationErr *PolicyValidationError
+	require.ErrorAs(t, malloryErr, &validationErr)
+	require.Equal(t, "mallory@example.com", validationErr.Validation.Data[0].User)
+	require.Contains(t, malloryErr.Error(), "cannot access tag:prod:22")
+	require.Equal(t, 1, posts)
+}
+
+// waitForQueuedWrites blocks until n writes are queued for the next commit.
+func waitForQueuedWrites(c *Client, n int) {
+	for c.batch.size() != n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMutatePolicyCommitsSingleWriteRightAway(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/hujson")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"groups": {"group:eng": ["alice@example.com"]}}`))
+	}))
+
+	started := time.Now()
+	result, _, err := c.AddEmailToGroup(context.Background(), "group:eng", "alice@example.com")
+	require.Nil(t, err)
+	require.False(t, result.Changed)
+	require.Less(t, time.Since(started), policyBatchWindow)
+
+	// A write this caller committed itself reports its result, even when
+	// its context is done by then.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 20; i++ {
+		result, _, err = c.AddEmailToGroup(ctx, "group:eng", "alice@example.com")
+		require.Nil(t, err)
+		require.False(t, result.Changed)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+)
+
+// policySnapshot is the last policy file read from the API, together with
+// the groups, rules and principals listed from it. It is kept across syncs,
+// and across runs in the policy store: the next read sends its ETag in
+// If-None-Match, and as long as the policy file did not change the parsed
+// file and everything listed from it are reused instead of parsing the
+// policy file again.
+type policySnapshot struct {
+	etag  string
+	body  []byte
+	store *policyStore
+
+	mtx sync.Mutex
+	// value is nil until the policy file is needed when the snapshot was
+	// loaded from the policy store.
+	value   *hujson.Value
+	results map[string]interface{}
+}
+
+func newPolicySnapshot(etag string, body []byte, value *hujson.Value, store *policyStore) *policySnapshot {
+	return &policySnapshot{
+		etag:    etag,
+		body:    body,
+		store:   store,
+		value:   value,
+		results: make(map[string]interface{}),
+	}
+}
+
+// parsedLocked returns the parsed policy file. p.mtx must be held.
+func (p *policySnapshot) parsedLocked() (*hujson.Value, error) {
+	if p.value == nil {
+		value, err := parsePolicy(p.body)
+		if err != nil {
+			return nil, err
+		}
+		p.value = value
+	}
+	return p.value, nil
+}
+
+// policy returns a copy of the policy file, which may be modified.
+func (p *policySnapshot) policy() (*hujson.Value, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	value, err := p.parsedLocked()
+	if err != nil {
+		return nil, err
+	}
+	clone := value.Clone()
+	return &clone, nil
+}
+
+// snapshotResult returns what compute listed from the policy file under
+// key, computing it once per version of the policy file.
+func snapshotResult[T any](
+	ctx context.Context,
+	p *policySnapshot,
+	key string,
+	compute func(value *hujson.Value) ([]T, error),
+) ([]T, error) {
+	logger := ctxzap.Extract(ctx)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if result, ok := p.results[key]; ok {
+		return result.([]T), nil
+	}
+
+	var result []T
+	found, err := p.store.loadResult(p.etag, key, &result)
+	if err != nil {
+		logger.Warn("tailscale-connector: failed to load policy result", zap.String("key", key), zap.Error(err))
+	}
+	if found {
+		p.results[key] = result
+		return result, nil
+	}
+
+	value, err := p.parsedLocked()
+	if err != nil {
+		return nil, err
+	}
+	result, err = compute(value)
+	if err != nil {
+		return nil, err
+	}
+	p.results[key] = result
+
+	err = p.store.saveResult(p.etag, key, result)
+	if err != nil {
+		logger.Warn("tailscale-connector: failed to save policy result", zap.String("key", key), zap.Error(err))
+	}
+	return result, nil
+}
+
+// getPolicy returns the current policy file. Within a sync the request is
+// shared through the sync cache, and across syncs an unchanged policy file
+// is not downloaded or parsed again.
+func (c *Client) getPolicy(ctx context.Context) (*policySnapshot, *v2.RateLimitDescription, error) {
+	c.policyMtx.Lock()
+	previous := c.policy
+	c.policyMtx.Unlock()
+
+	ifNoneMatch := ""
+	if previous != nil {
+		ifNoneMatch = previous.etag
+	}
+
+	key := http.MethodGet + " " + c.aclPath()
+	response, err := c.cache.do(ctx, key, func() (*cachedResponse, error) {
+		return c.makeRequest(ctx, http.MethodGet, nil, "", ifNoneMatch)
+	})
+	if err != nil {
+		return nil, response.ratelimit(), err
+	}
+
+	if response.notModified {
+		if previous != nil && previous.etag == response.etag {
+			return previous, response.ratelimitData, nil
+		}
+
+		// The snapshot the request was made for has been replaced since.
+		response, err = c.makeRequest(ctx, http.MethodGet, nil, "", "")
+		if err != nil {
+			return nil, response.ratelimit(), err
+		}
+	}
+
+	c.policyMtx.Lock()
+	defer c.policyMtx.Unlock()
+
+	if c.policy != nil && response.etag != "" && c.policy.etag == response.etag {
+		return c.policy, response.ratelimitData, nil
+	}
+
+	value, err := parsePolicy(response.body)
+	if err != nil {
+		return nil, response.ratelimitData, err
+	}
+
+	c.policy = newPolicySnapshot(response.etag, response.body, value, c.store)
+	err = c.store.savePolicy(response.etag, response.body)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("tailscale-connector: failed to save policy file", zap.Error(err))
+	}
+	return c.policy, response.ratelimitData, nil
+}
+
+// listFromPolicy lists values from the current policy file. The list is
+// computed once per version of the policy file and shared, so every caller
+// gets its own copy.
+func listFromPolicy[T any](
+	ctx context.Context,
+	c *Client,
+	key string,
+	compute func(value *hujson.Value) ([]T, error),
+) ([]T, *v2.RateLimitDescription, error) {
+	snapshot, ratelimitData, err := c.getPolicy(ctx)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	result, err := snapshotResult(ctx, snapshot, key, compute)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return slices.Clone(result), ratelimitData, nil
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicySnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	etag := `"v1"`
+	policy := `{"groups": {"group:eng": ["user@example.com"]}}`
+	var ifNoneMatch []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/hujson")
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(policy))
+	}))
+	c.cache = newSyncCache()
+
+	groups, _, err := c.ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []Resource{{Id: "group:eng", DisplayName: "eng"}}, groups)
+	snapshot := c.policy
+
+	// The next sync only checks whether the policy file changed and reuses
+	// the groups listed from it.
+	groups[0].DisplayName = "changed by the caller"
+	c.ClearSyncCache()
+	groups, _, err = c.ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []Resource{{Id: "group:eng", DisplayName: "eng"}}, groups)
+	require.Same(t, snapshot, c.policy)
+	require.Equal(t, []string{"", `"v1"`}, ifNoneMatch)
+
+	// A changed policy file is parsed again.
+	etag = `"v2"`
+	policy = `{"groups": {"group:ops": ["user@example.com"]}}`
+	c.ClearSyncCache()
+	groups, _, err = c.ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []Resource{{Id: "group:ops", DisplayName: "ops"}}, groups)
+	require.Equal(t, `"v2"`, c.policy.etag)
+
+	// The policy file returned by get is a copy and leaves the snapshot intact.
+	value, _, _, err := c.get(ctx)
+	require.Nil(t, err)
+	value.Value = nil
+	members, _, err := c.ListGroupMemberships(ctx, "group:ops")
+	require.Nil(t, err)
+	require.Equal(t, []string{"user@example.com"}, members)
+}
+
+func TestPolicySnapshotStoredBetweenRuns(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	var ifNoneMatch []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/hujson")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"groups": {"group:eng": ["user@example.com"]}}`))
+	})
+
+	newStoredClient := func() *Client {
+		c := newTestClient(t, handler)
+		c.store = newPolicyStore(dir, c.tailnet)
+		policy, err := c.store.load()
+		require.Nil(t, err)
+		c.policy = policy
+		return c
+	}
+
+	groups, _, err := newStoredClient().ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []Resource{{Id: "group:eng", DisplayName: "eng"}}, groups)
+
+	// The next run checks whether the policy file changed and lists the
+	// groups saved by the previous one, without parsing the policy file.
+	c := newStoredClient()
+	require.Equal(t, `"v1"`, c.policy.etag)
+	groups, _, err = c.ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []Resource{{Id: "group:eng", DisplayName: "eng"}}, groups)
+	require.Equal(t, []string{"", `"v1"`}, ifNoneMatch)
+	require.Nil(t, c.policy.value)
+
+	// What was not listed before is computed from the saved policy file.
+	members, _, err := c.ListGroupMemberships(ctx, "group:eng")
+	require.Nil(t, err)
+	require.Equal(t, []string{"user@example.com"}, members)
+}
+
+func TestPolicyStoreDropsOtherVersions(t *testing.T) {
+	store := newPolicyStore(t.TempDir(), "example.com")
+	require.Nil(t, store.savePolicy(`"v1"`, []byte(`{}`)))
+	require.Nil(t, store.saveResult(`"v1"`, "groups", []string{"group:eng"}))
+
+	policy, err := store.load()
+	require.Nil(t, err)
+	require.Equal(t, `"v1"`, policy.etag)
+	var groups []string
+	found, err := store.loadResult(`"v1"`, "groups", &groups)
+	require.Nil(t, err)
+	require.True(t, found)
+
+	// Entries saved by an older release, without a version, are dropped.
+	data, err := json.Marshal(storedPolicy{ETag: `"v1"`, Body: `{}`})
+	require.Nil(t, err)
+	require.Nil(t, writeFileAtomic(filepath.Join(store.dir, storedPolicyFile), data))
+	data, err = json.Marshal(storedResult{ETag: `"v1"`, Key: "groups", Result: json.RawMessage(`["group:eng"]`)})
+	require.Nil(t, err)
+	require.Nil(t, writeFileAtomic(store.resultPath("groups"), data))
+
+	policy, err = store.load()
+	require.Nil(t, err)
+	require.Nil(t, policy)
+	found, err = store.loadResult(`"v1"`, "groups", &groups)
+	require.Nil(t, err)
+	require.False(t, found)
+}
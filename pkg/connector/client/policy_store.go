@@ -0,0 +1,186 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	storedPolicyFile = "policy.json"
+	storedResultsDir = "results"
+	// policyStoreVersion is the version of what the store saves. Bump it
+	// whenever a listed result changes its shape or meaning, e.g. how rules
+	// are hashed, so that entries saved by older releases are dropped.
+	policyStoreVersion = 1
+)
+
+// policyStore keeps the last policy file read and what was listed from it
+// on disk, so that the next run sends its ETag in If-None-Match and reuses
+// the listed groups, rules and sources when the policy file did not change.
+// A nil policyStore keeps nothing.
+type policyStore struct {
+	dir string
+}
+
+type storedPolicy struct {
+	Version int    `json:"version"`
+	ETag    string `json:"etag"`
+	Body    string `json:"body"`
+}
+
+type storedResult struct {
+	Version int             `json:"version"`
+	ETag    string          `json:"etag"`
+	Key     string          `json:"key"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// newPolicyStore keeps the policy file of the tailnet under cacheDir. It
+// returns nil when cacheDir is empty.
+func newPolicyStore(cacheDir string, tailnet string) *policyStore {
+	if cacheDir == "" {
+		return nil
+	}
+	return &policyStore{
+		dir: filepath.Join(cacheDir, "policy-"+storeName(tailnet)),
+	}
+}
+
+// load returns the snapshot saved by a previous run, or nil if there is none
+// or it was saved by another version of the store.
+func (s *policyStore) load() (*policySnapshot, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, storedPolicyFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored storedPolicy
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Version != policyStoreVersion || stored.ETag == "" {
+		return nil, nil
+	}
+
+	return newPolicySnapshot(stored.ETag, []byte(stored.Body), nil, s), nil
+}
+
+// savePolicy saves a new version of the policy file and drops what was
+// listed from the previous one.
+func (s *policyStore) savePolicy(etag string, body []byte) error {
+	if s == nil || etag == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(filepath.Join(s.dir, storedResultsDir))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(storedPolicy{Version: policyStoreVersion, ETag: etag, Body: string(body)})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, storedPolicyFile), data)
+}
+
+// loadResult decodes what was listed under key from the version etag of the
+// policy file into target, and reports whether it was found. Results saved
+// by another version of the store are not found.
+func (s *policyStore) loadResult(etag string, key string, target interface{}) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.resultPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var stored storedResult
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return false, err
+	}
+	if stored.Version != policyStoreVersion || stored.ETag != etag || stored.Key != key {
+		return false, nil
+	}
+
+	err = json.Unmarshal(stored.Result, target)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// saveResult saves what was listed under key from the version etag of the
+// policy file.
+func (s *policyStore) saveResult(etag string, key string, result interface{}) error {
+	if s == nil || etag == "" {
+		return nil
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(storedResult{Version: policyStoreVersion, ETag: etag, Key: key, Result: resultJSON})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.resultPath(key), data)
+}
+
+func (s *policyStore) resultPath(key string) string {
+	return filepath.Join(s.dir, storedResultsDir, storeName(key)+".json")
+}
+
+// storeName turns a tailnet or result key, which may contain any
+// character, into a file name.
+func storeName(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:32]
+}
+
+// writeFileAtomic replaces the file at path, so that a concurrent run never
+// reads a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
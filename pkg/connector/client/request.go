@@ -2,7 +2,6 @@ package client
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,29 +19,77 @@ const (
 	apiPathACL  = "/tailnet/%s/acl"
 	baseUrl     = "https://api.tailscale.com/api/v2"
 	contentType = "application/hujson"
-	groupPrefix = "group:"
 	ifMatch     = "If-Match"
+	ifNoneMatch = "If-None-Match"
 )
 
+// Prefixes of the group and autogroup names in the policy file.
+const (
+	GroupPrefix     = "group:"
+	AutogroupPrefix = "autogroup:"
+)
+
+func (c *Client) aclPath() string {
+	return fmt.Sprintf(apiPathACL, c.tailnet)
+}
+
 func (c *Client) getACLUrl() (*url.URL, error) {
-	aclUrl, err := url.Parse(baseUrl + fmt.Sprintf(apiPathACL, c.tailnet))
+	aclUrl, err := url.Parse(c.baseUrl.String() + c.aclPath())
 	if err != nil {
 		return nil, fmt.Errorf("tailscale-connector: error parsing acl url: %w", err)
 	}
+	return disableCache(aclUrl), nil
+}
+
+// disableCache adds a unique query parameter to the url, so that the
+// response is never served from the http client's cache.
+func disableCache(u *url.URL) *url.URL {
 	uid := ksuid.New().String()
-	q := aclUrl.Query()
+	q := u.Query()
 	q.Set("baton-disable-cache", uid)
-	aclUrl.RawQuery = q.Encode()
-	return aclUrl, nil
+	u.RawQuery = q.Encode()
+	return u
 }
 
+// get reads the policy file. The returned value is a copy of the current
+// policy snapshot and may be modified.
 func (c *Client) get(ctx context.Context) (
 	*hujson.Value,
 	string,
 	*v2.RateLimitDescription,
 	error,
 ) {
-	return c.makeRequest(ctx, http.MethodGet, nil, "")
+	snapshot, ratelimitData, err := c.getPolicy(ctx)
+	if err != nil {
+		return nil, "", ratelimitData, err
+	}
+
+	value, err := snapshot.policy()
+	if err != nil {
+		return nil, "", ratelimitData, err
+	}
+	return value, snapshot.etag, ratelimitData, nil
+}
+
+// getForUpdate reads the policy file bypassing the sync cache. Use it to
+// read the policy file that a write is computed from.
+func (c *Client) getForUpdate(ctx context.Context) (
+	*hujson.Value,
+	string,
+	*v2.RateLimitDescription,
+	error,
+) {
+	response, err := c.makeRequest(ctx, http.MethodGet, nil, "", "")
+	if err != nil {
+		return nil, "", response.ratelimit(), err
+	}
+
+	parsed, err := parsePolicy(response.body)
+	if err != nil {
+		return nil, "", response.ratelimitData, err
+	}
+
+	return parsed, response.etag, response.ratelimitData, nil
 }
 
 func (c *Client) post(ctx context.Context, requestBody []byte, etag string) (
@@ -50,35 +97,68 @@ func (c *Client) post(ctx context.Context, requestBody []byte, etag string) (
 	*v2.RateLimitDescription,
 	error,
 ) {
-	value, _, ratelimitData, err := c.makeRequest(
+	response, err := c.makeRequest(
 		ctx,
 		http.MethodPost,
 		requestBody,
 		etag,
+		"",
 	)
-	return value, ratelimitData, err
+	c.cache.clear()
+	if err != nil {
+		return nil, response.ratelimit(), err
+	}
+
+	parsed, err := parsePolicy(response.body)
+	if err != nil {
+		return nil, response.ratelimitData, err
+	}
+
+	return parsed, response.ratelimitData, nil
+}
+
+func parsePolicy(body []byte) (*hujson.Value, error) {
+	// TODO(marcos): The original parser would only read up to 256 kB.
+	// Should we also error when that happens?
+	parsed, err := hujson.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("tailscale-connector: %w", err)
+	}
+	return &parsed, nil
 }
 
+// makeRequest sends a request for the policy file and returns the raw
+// response. Writes are conditional on etag. Reads with a previousEtag are
+// conditional on the policy file having changed since, and return a
+// response marked as not modified otherwise. On errors the response only
+// carries the rate limit data.
 func (c *Client) makeRequest(
 	ctx context.Context,
 	method string,
 	requestBody []byte,
 	etag string,
-) (
-	*hujson.Value,
-	string,
-	*v2.RateLimitDescription,
-	error,
-) {
+	previousEtag string,
+) (*cachedResponse, error) {
 	logger := ctxzap.Extract(ctx)
 	path, err := c.getACLUrl()
 	if err != nil {
-		return nil, "", nil, err
+		return nil, err
+	}
+
+	var token string
+	if method == http.MethodGet {
+		token, err = c.readToken(ctx)
+	} else {
+		token, err = c.writeToken(ctx)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	options := []uhttp.RequestOption{
 		uhttp.WithAccept(contentType),
 		uhttp.WithContentType(contentType),
+		WithAuthorizationBearerHeader(token),
 	}
 
 	if requestBody != nil {
@@ -87,6 +167,9 @@ func (c *Client) makeRequest(
 	if etag != "" {
 		options = append(options, uhttp.WithHeader(ifMatch, etag))
 	}
+	if previousEtag != "" {
+		options = append(options, uhttp.WithHeader(ifNoneMatch, previousEtag))
+	}
 
 	request, err := c.wrapper.NewRequest(
 		ctx,
@@ -95,47 +178,49 @@ func (c *Client) makeRequest(
 		options...,
 	)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, err
 	}
 
-	request.SetBasicAuth(c.apiKey, "")
-
 	ratelimitData := v2.RateLimitDescription{}
 	response, err := c.wrapper.Do(
 		request,
 		uhttp.WithRatelimitData(&ratelimitData),
 	)
 	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotModified {
+			response.Body.Close()
+			return &cachedResponse{
+				etag:          previousEtag,
+				notModified:   true,
+				ratelimitData: &ratelimitData,
+			}, nil
+		}
 		if response != nil && response.StatusCode == http.StatusPreconditionFailed {
 			logger.Error(
 				"tailscale: precondition failed, the etag didn't match",
 				zap.Int("status_code", response.StatusCode),
 			)
-			return nil, "", &ratelimitData, errors.New("error updating tailscale grants: precondition failed")
+			return &cachedResponse{ratelimitData: &ratelimitData}, errPreconditionFailed
 		}
 
-		return nil, "", &ratelimitData, err
+		return &cachedResponse{ratelimitData: &ratelimitData}, err
 	}
 
 	responseContentType := response.Header.Get("content-type")
 	// We expect the content type to be `application/hujson`.
 	if !uhttp.IsJSONContentType(responseContentType) {
-		return nil, "", nil, fmt.Errorf("unexpected content type for json response: %s", responseContentType)
+		return nil, fmt.Errorf("unexpected content type for json response: %s", responseContentType)
 	}
 
 	defer response.Body.Close()
 	bodyBytes, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	// TODO(marcos): The original parser would only read up to 256 kB.
-	// Should we also error when that happens?
-	parsed, err := hujson.Parse(bodyBytes)
-	if err != nil {
-		return nil, "", nil, fmt.Errorf("tailscale-connector: %w", err)
+		return nil, err
 	}
 
-	etag = response.Header.Get("etag")
-	return &parsed, etag, &ratelimitData, nil
+	return &cachedResponse{
+		body:          bodyBytes,
+		etag:          response.Header.Get("etag"),
+		ratelimitData: &ratelimitData,
+	}, nil
 }
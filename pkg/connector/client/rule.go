@@ -19,8 +19,9 @@ type rule struct {
 }
 
 const (
-	RuleKeySSH  ruleKey = "ssh"
-	RuleKeyACLs ruleKey = "acls"
+	RuleKeySSH    ruleKey = "ssh"
+	RuleKeyACLs   ruleKey = "acls"
+	RuleKeyGrants ruleKey = "grants"
 )
 
 func (r rule) GetValueOfNamedMember(name string) []string {
@@ -48,6 +49,63 @@ func (r rule) GetValueOfNamedMember(name string) []string {
 	return []string{}
 }
 
+// GetNamesOfObjectMember returns the member names of a named object,
+// e.g. the capability names of a grant's `app` object.
+func (r rule) GetNamesOfObjectMember(name string) []string {
+	for _, member := range r.obj.Members {
+		literalName, err := connutils.GetObjectMemberName(member)
+		if err != nil || literalName != name {
+			continue
+		}
+
+		object, ok := member.Value.Value.(*hujson.Object)
+		if !ok {
+			return []string{}
+		}
+
+		names := []string{}
+		for _, objectMember := range object.Members {
+			objectMemberName, err := connutils.GetObjectMemberName(objectMember)
+			if err != nil {
+				continue
+			}
+			names = append(names, objectMemberName)
+		}
+		return names
+	}
+	return []string{}
+}
+
+// GetObjectMemberValues returns the members of a named object as
+// `name=value`, with each value packed as minimized JSON, e.g. the app
+// capabilities of a grant together with their parameters.
+func (r rule) GetObjectMemberValues(name string) []string {
+	for _, member := range r.obj.Members {
+		literalName, err := connutils.GetObjectMemberName(member)
+		if err != nil || literalName != name {
+			continue
+		}
+
+		object, ok := member.Value.Value.(*hujson.Object)
+		if !ok {
+			return []string{}
+		}
+
+		values := []string{}
+		for _, objectMember := range object.Members {
+			objectMemberName, err := connutils.GetObjectMemberName(objectMember)
+			if err != nil {
+				continue
+			}
+			value := objectMember.Value.Clone()
+			value.Minimize()
+			values = append(values, objectMemberName+"="+string(value.Pack()))
+		}
+		return values
+	}
+	return []string{}
+}
+
 func (r rule) GetHash() string {
 	action := r.GetValueOfNamedMember("action")
 	dst := r.GetValueOfNamedMember("dst")
@@ -64,6 +122,110 @@ func (r rule) GetHash() string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(actionStr+dstStr+usersStr)))
 }
 
+// GetGrantHash identifies a grant by everything but its `src`, so that the
+// ID stays stable while principals are provisioned. App capabilities are
+// hashed with their parameters. Grants that only differ in their `src` hash
+// the same, RuleHashes tells them apart.
+func (r rule) GetGrantHash() string {
+	fields := [][]string{
+		r.GetValueOfNamedMember("dst"),
+		r.GetValueOfNamedMember("ip"),
+		r.GetObjectMemberValues("app"),
+		r.GetValueOfNamedMember("via"),
+	}
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		sort.Strings(field)
+		parts = append(parts, strings.Join(field, ","))
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(parts, "|"))))
+}
+
+// hash returns the hash used to identify a rule of the given kind.
+func (r rule) hash(ruleKey ruleKey) string {
+	if ruleKey == RuleKeyGrants {
+		return r.GetGrantHash()
+	}
+	return r.GetHash()
+}
+
+// RuleHashes returns the hash identifying each of the rules. Grants that
+// hash the same, i.e. only differ in their `src`, get an occurrence suffix
+// after the first one, so that every grant hash is unique within the policy
+// file. ACL and SSH rules keep their plain hash, so their IDs do not change;
+// they are only provisioned when the hash is unambiguous.
+func RuleHashes(rules []rule, ruleKey ruleKey) []string {
+	hashes := make([]string, 0, len(rules))
+	occurrences := make(map[string]int)
+	for _, r := range rules {
+		hash := r.hash(ruleKey)
+		if ruleKey != RuleKeyGrants {
+			hashes = append(hashes, hash)
+			continue
+		}
+		occurrences[hash]++
+		if occurrences[hash] > 1 {
+			hash = fmt.Sprintf("%s-%d", hash, occurrences[hash])
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// findRule returns the one rule identified by ruleHash. Rules are only
+// provisioned when the hash is unambiguous.
+func findRule(input *hujson.Value, ruleKey ruleKey, ruleHash string) (rule, error) {
+	rules, err := GetRulesFromHujson(input.Value, ruleKey)
+	if err != nil {
+		return rule{}, err
+	}
+
+	var found []rule
+	for i, hash := range RuleHashes(rules, ruleKey) {
+		if hash == ruleHash {
+			found = append(found, rules[i])
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return rule{}, errors.New("no rule found for that hash")
+	case 1:
+		return found[0], nil
+	default:
+		return rule{}, fmt.Errorf("%d rules found for that hash, refusing to change them", len(found))
+	}
+}
+
+// sourceArrays returns the arrays principals are provisioned into: the
+// `src` array, and the `users` array of an ACL rule.
+func (r rule) sourceArrays(ruleKey ruleKey) ([]*hujson.Array, error) {
+	arrays := []*hujson.Array{}
+	for _, ruleMember := range r.obj.Members {
+		ruleName, err := connutils.GetObjectMemberName(ruleMember)
+		if err != nil {
+			return nil, err
+		}
+		if isSourceMember(ruleName, ruleKey) {
+			ruleMemberList, ok := ruleMember.Value.Value.(*hujson.Array)
+			if !ok {
+				return nil, errors.New("rule list was not an array")
+			}
+			arrays = append(arrays, ruleMemberList)
+		}
+	}
+	return arrays, nil
+}
+
+// isSourceMember reports whether a rule member lists the rule's principals:
+// `src`, and the `users` of an ACL rule. The `users` of an SSH rule are the
+// users to log in as on the destination.
+func isSourceMember(memberName string, ruleKey ruleKey) bool {
+	return memberName == "src" || (memberName == "users" && ruleKey == RuleKeyACLs)
+}
+
 func GetRulesFromHujson(input hujson.ValueTrimmed, ruleKey ruleKey) ([]rule, error) {
 	rv := []rule{}
 	rootObj, ok := input.(*hujson.Object)
@@ -104,61 +266,20 @@ func FindRuleArray(
 	ruleKey ruleKey,
 	ruleHash string,
 ) (*hujson.Array, error) {
-	rootObj, ok := input.Value.(*hujson.Object)
-	if !ok {
-		return nil, errors.New("root value was not an object")
+	foundRule, err := findRule(input, ruleKey, ruleHash)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, member := range rootObj.Members {
-		name, err := connutils.GetObjectMemberName(member)
-		if err != nil {
-			return nil, err
-		}
-		// oneof: ssh or acls
-		if name != string(ruleKey) {
-			continue
-		}
-
-		rules, ok := member.Value.Value.(*hujson.Array)
-		if !ok {
-			return nil, errors.New("rule value was not an array")
-		}
-
-		for _, ruleElement := range rules.Elements {
-			ruleObj, ok := ruleElement.Value.(*hujson.Object)
-			if !ok {
-				return nil, errors.New("rule was not an object")
-			}
-
-			rule := rule{obj: ruleObj}
-			hash := rule.GetHash()
-			if hash != ruleHash {
-				continue
-			}
-
-			for _, ruleMember := range ruleObj.Members {
-				ruleName, err := connutils.GetObjectMemberName(ruleMember)
-				if err != nil {
-					return nil, err
-				}
-				// If it's a 'src' array, or it's an ACL users array, remove our email
-				if ruleName == "src" || (ruleName == "users" && ruleKey == RuleKeyACLs) {
-					ruleMemberList, ok := ruleMember.Value.Value.(*hujson.Array)
-					if !ok {
-						return nil, errors.New("rule list was not an array")
-					}
-
-					return ruleMemberList, nil
-				}
-			}
-
-			break
-		}
-
-		break
+	arrays, err := foundRule.sourceArrays(ruleKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(arrays) == 0 {
+		return nil, errors.New("no rule found for that hash")
 	}
 
-	return nil, errors.New("no rule found for that hash")
+	return arrays[0], nil
 }
 
 func AddEmailToRule(
@@ -206,81 +327,37 @@ func RemoveEmailFromRule(
 	ruleHash string,
 	email string,
 ) (bool, error) {
-	wasRemoved := false
-	foundRuleForHash := false
-
-	rootObj, ok := input.Value.(*hujson.Object)
-	if !ok {
-		return false, errors.New("root value was not an object")
+	foundRule, err := findRule(input, ruleKey, ruleHash)
+	if err != nil {
+		return false, err
 	}
 
-	for _, member := range rootObj.Members {
-		name, err := connutils.GetObjectMemberName(member)
-		if err != nil {
-			return wasRemoved, err
-		}
-
-		// oneof: ssh or acls
-		if name != string(ruleKey) {
-			continue
-		}
-
-		rules, ok := member.Value.Value.(*hujson.Array)
-		if !ok {
-			return wasRemoved, errors.New("rule value was not an array")
-		}
+	arrays, err := foundRule.sourceArrays(ruleKey)
+	if err != nil {
+		return false, err
+	}
 
-		for _, ruleElement := range rules.Elements {
-			ruleObj, ok := ruleElement.Value.(*hujson.Object)
+	// Remove our email from the 'src' array, or the ACL users array
+	wasRemoved := false
+	for _, ruleMemberList := range arrays {
+		for i := 0; i < len(ruleMemberList.Elements); i++ {
+			element := ruleMemberList.Elements[i]
+			literalEmail, ok := element.Value.(hujson.Literal)
 			if !ok {
-				return wasRemoved, errors.New("rule was not an object")
-			}
-
-			rule := rule{obj: ruleObj}
-			hash := rule.GetHash()
-			if hash != ruleHash {
 				continue
 			}
-			foundRuleForHash = true
-
-			for _, ruleMember := range ruleObj.Members {
-				ruleName, err := connutils.GetObjectMemberName(ruleMember)
-				if err != nil {
-					return wasRemoved, err
-				}
 
-				// If it's a 'src' array, or it's an ACL users array, remove our email
-				if ruleName == "src" || (ruleName == "users" && ruleKey == RuleKeyACLs) {
-					ruleMemberList, ok := ruleMember.Value.Value.(*hujson.Array)
-					if !ok {
-						return wasRemoved, errors.New("rule list was not an array")
-					}
-
-					for i := 0; i < len(ruleMemberList.Elements); i++ {
-						element := ruleMemberList.Elements[i]
-						literalEmail, ok := element.Value.(hujson.Literal)
-						if !ok {
-							continue
-						}
-
-						if literalEmail.String() == email {
-							ruleMemberList.Elements = append(
-								ruleMemberList.Elements[:i],
-								ruleMemberList.Elements[i+1:]...,
-							)
-							wasRemoved = true
-							i--
-						}
-					}
-				}
+			if literalEmail.String() == email {
+				ruleMemberList.Elements = append(
+					ruleMemberList.Elements[:i],
+					ruleMemberList.Elements[i+1:]...,
+				)
+				wasRemoved = true
+				i--
 			}
 		}
 	}
 
-	if !foundRuleForHash {
-		return wasRemoved, errors.New("no rule found for that hash")
-	}
-
 	input.Format()
 	return wasRemoved, nil
 }
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/conductorone/baton-tailscale/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/hujson"
+)
+
+func TestGetGrantsFromHujson(t *testing.T) {
+	val, err := hujson.Parse([]byte(test.MinimalGrantsExample))
+	require.Nil(t, err)
+
+	grants, err := GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+	require.Len(t, grants, 2)
+
+	require.Equal(t, []string{"group:devs", "john.degner@insulator.one"}, grants[0].GetValueOfNamedMember("src"))
+	require.Equal(t, []string{}, grants[0].GetNamesOfObjectMember("app"))
+	require.Equal(t, []string{"tailscale.com/cap/kubernetes"}, grants[1].GetNamesOfObjectMember("app"))
+}
+
+func TestAddEmailToGrantHujson(t *testing.T) {
+	ctx := context.Background()
+	val, err := hujson.Parse([]byte(test.MinimalGrantsExample))
+	require.Nil(t, err)
+
+	grants, err := GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+	hash := grants[0].GetGrantHash()
+
+	_, err = AddEmailToRule(ctx, &val, RuleKeyGrants, hash, "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.Equal(t, test.ExpectedGrantsResult, val.String())
+
+	// Provisioning the src of a grant must not change its ID.
+	grants, err = GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+	require.Equal(t, hash, grants[0].GetGrantHash())
+
+	_, err = RemoveEmailFromRule(ctx, &val, RuleKeyGrants, hash, "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.Equal(t, test.MinimalGrantsExample, val.String())
+}
+
+func TestListGrantSources(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(test.MinimalGrantsExample))
+	}))
+
+	val, err := hujson.Parse([]byte(test.MinimalGrantsExample))
+	require.Nil(t, err)
+	grants, err := GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+
+	sources, _, err := c.ListGrantSources(ctx, "grant:"+grants[0].GetGrantHash())
+	require.Nil(t, err)
+	require.Equal(t, []string{"group:devs", "john.degner@insulator.one"}, sources)
+}
+
+func TestListSSHSourcesSkipsSSHUsers(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(test.MinimalSSHExample))
+	}))
+
+	val, err := hujson.Parse([]byte(test.MinimalSSHExample))
+	require.Nil(t, err)
+	rules, err := GetRulesFromHujson(val.Value, RuleKeySSH)
+	require.Nil(t, err)
+
+	// `autogroup:nonroot` in `users` is who to log in as, not a source.
+	sources, _, err := c.ListSSHSources(ctx, "ssh:"+rules[0].GetHash())
+	require.Nil(t, err)
+	require.Equal(t, []string{"autogroup:members"}, sources)
+}
+
+func TestDuplicateGrantHashes(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/acl", r.URL.Path)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(test.DuplicateGrantsExample))
+	}))
+
+	grants, _, err := c.ListGrants(ctx)
+	require.Nil(t, err)
+	require.Len(t, grants, 4)
+
+	ids := map[string]bool{}
+	for _, grant := range grants {
+		ids[grant.Id] = true
+	}
+	require.Len(t, ids, 4)
+
+	// Grants that only differ in their sources keep their own sources.
+	sources, _, err := c.ListGrantSources(ctx, grants[0].Id)
+	require.Nil(t, err)
+	require.Equal(t, []string{"group:eng"}, sources)
+	sources, _, err = c.ListGrantSources(ctx, grants[1].Id)
+	require.Nil(t, err)
+	require.Equal(t, []string{"group:ops"}, sources)
+
+	val, err := hujson.Parse([]byte(test.DuplicateGrantsExample))
+	require.Nil(t, err)
+	rules, err := GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+	hashes := RuleHashes(rules, RuleKeyGrants)
+	require.Equal(t, hashes[0]+"-2", hashes[1])
+	require.NotEqual(t, hashes[2], hashes[3])
+
+	wasAdded, err := AddEmailToRule(ctx, &val, RuleKeyGrants, hashes[1], "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.True(t, wasAdded)
+
+	rules, err = GetRulesFromHujson(val.Value, RuleKeyGrants)
+	require.Nil(t, err)
+	require.Equal(t, []string{"group:eng"}, rules[0].GetValueOfNamedMember("src"))
+	require.Equal(t, []string{"group:ops", "bonk.flambe@insulator.one"}, rules[1].GetValueOfNamedMember("src"))
+	require.Equal(t, hashes, RuleHashes(rules, RuleKeyGrants))
+
+	wasRemoved, err := RemoveEmailFromRule(ctx, &val, RuleKeyGrants, hashes[1], "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.True(t, wasRemoved)
+	require.Equal(t, test.DuplicateGrantsExample, val.String())
+}
+
+func TestDuplicateACLHashesKeepTheirHash(t *testing.T) {
+	val, err := hujson.Parse([]byte(`{
+	"acls": [
+		{"action": "accept", "src": ["group:eng"], "dst": ["tag:prod:*"]},
+		{"action": "accept", "src": ["group:ops"], "dst": ["tag:prod:*"]},
+	],
+}`))
+	require.Nil(t, err)
+	rules, err := GetRulesFromHujson(val.Value, RuleKeyACLs)
+	require.Nil(t, err)
+
+	hashes := RuleHashes(rules, RuleKeyACLs)
+	require.Equal(t, []string{rules[0].GetHash(), rules[1].GetHash()}, hashes)
+	require.Equal(t, hashes[0], hashes[1])
+
+	_, err = AddEmailToRule(context.Background(), &val, RuleKeyACLs, hashes[0], "bonk.flambe@insulator.one")
+	require.NotNil(t, err)
+}
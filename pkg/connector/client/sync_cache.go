@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// cachedResponse is the raw body of a read request, so that every caller
+// decodes or parses its own copy.
+type cachedResponse struct {
+	body          []byte
+	etag          string
+	notModified   bool
+	ratelimitData *v2.RateLimitDescription
+}
+
+func (r *cachedResponse) ratelimit() *v2.RateLimitDescription {
+	if r == nil {
+		return nil
+	}
+	return r.ratelimitData
+}
+
+type syncCacheEntry struct {
+	done     chan struct{}
+	response *cachedResponse
+	err      error
+}
+
+// syncCache shares the responses of read requests between the resource
+// builders of one sync, so that e.g. the policy file or the user list is
+// fetched once instead of once per group or rule. Concurrent requests for
+// the same endpoint wait for the first one. It is cleared when a sync starts
+// and after every write. A nil syncCache caches nothing.
+type syncCache struct {
+	mtx     sync.Mutex
+	entries map[string]*syncCacheEntry
+}
+
+func newSyncCache() *syncCache {
+	return &syncCache{
+		entries: make(map[string]*syncCacheEntry),
+	}
+}
+
+// do returns the cached response for key, calling fetch if there is none.
+// Failed requests are not cached.
+func (s *syncCache) do(
+	ctx context.Context,
+	key string,
+	fetch func() (*cachedResponse, error),
+) (*cachedResponse, error) {
+	if s == nil {
+		return fetch()
+	}
+
+	s.mtx.Lock()
+	entry, ok := s.entries[key]
+	if ok {
+		s.mtx.Unlock()
+		select {
+		case <-entry.done:
+			return entry.response, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	entry = &syncCacheEntry{done: make(chan struct{})}
+	s.entries[key] = entry
+	s.mtx.Unlock()
+
+	entry.response, entry.err = fetch()
+	close(entry.done)
+
+	if entry.err != nil {
+		s.mtx.Lock()
+		if s.entries[key] == entry {
+			delete(s.entries, key)
+		}
+		s.mtx.Unlock()
+	}
+
+	return entry.response, entry.err
+}
+
+func (s *syncCache) clear() {
+	if s == nil {
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.entries = make(map[string]*syncCacheEntry)
+}
+
+// enabled reports whether responses are shared. The http client's own cache
+// is bypassed while they are, so that clearing the sync cache after a write
+// is enough to read the change back.
+func (s *syncCache) enabled() bool {
+	return s != nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCache(t *testing.T) {
+	ctx := context.Background()
+
+	requests := make(map[string]int)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		switch r.URL.Path {
+		case "/tailnet/example.com/users":
+			// The http client's cache is always bypassed, the sync cache is the
+			// only one.
+			assert.True(t, r.URL.Query().Has("baton-disable-cache"))
+			w.Header().Set("Content-Type", "application/json")
+			assert.Nil(t, json.NewEncoder(w).Encode(UsersAPIData{Users: []User{{ID: "u1"}}}))
+		case "/tailnet/example.com/acl":
+			w.Header().Set("Content-Type", "application/hujson")
+			_, _ = w.Write([]byte(`{"groups": {"group:eng": ["user@example.com"]}}`))
+		case "/users/u1":
+			w.Header().Set("Content-Type", "application/json")
+			assert.Nil(t, json.NewEncoder(w).Encode(User{ID: "u1", Status: "suspended"}))
+		}
+	}))
+	c.cache = newSyncCache()
+
+	for i := 0; i < 3; i++ {
+		users, _, err := c.GetUsers(ctx)
+		require.Nil(t, err)
+		require.Len(t, users, 1)
+
+		groups, _, err := c.ListGroups(ctx)
+		require.Nil(t, err)
+		require.Len(t, groups, 1)
+	}
+	require.Equal(t, 1, requests["GET /tailnet/example.com/users"])
+	require.Equal(t, 1, requests["GET /tailnet/example.com/acl"])
+
+	// Writes read the policy file they change fresh.
+	_, _, _, err := c.getForUpdate(ctx)
+	require.Nil(t, err)
+	require.Equal(t, 2, requests["GET /tailnet/example.com/acl"])
+
+	// Writes drop the shared responses.
+	_, _, err = c.SuspendUser(ctx, "u1")
+	require.Nil(t, err)
+	_, _, err = c.GetUsers(ctx)
+	require.Nil(t, err)
+	require.Equal(t, 2, requests["GET /tailnet/example.com/users"])
+
+	c.ClearSyncCache()
+	_, _, err = c.ListGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, 3, requests["GET /tailnet/example.com/acl"])
+
+	// Without the sync cache, every read goes to the API.
+	c.cache = nil
+	for i := 0; i < 2; i++ {
+		_, _, err = c.GetUsers(ctx)
+		require.Nil(t, err)
+	}
+	require.Equal(t, 4, requests["GET /tailnet/example.com/users"])
+}
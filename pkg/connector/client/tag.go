@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"github.com/tailscale/hujson"
+)
+
+const (
+	tagOwnersKey = "tagOwners"
+	tagPrefix    = "tag:"
+)
+
+func getTagOwnersObject(input hujson.ValueTrimmed) (*hujson.Object, error) {
+	rootObj, ok := input.(*hujson.Object)
+	if !ok {
+		return nil, errors.New("root value was not an object")
+	}
+	for _, member := range rootObj.Members {
+		name, err := connutils.GetObjectMemberName(member)
+		if err != nil {
+			return nil, err
+		}
+		if name != tagOwnersKey {
+			continue
+		}
+
+		tagOwners, ok := member.Value.Value.(*hujson.Object)
+		if !ok {
+			return nil, errors.New("tagOwners was not an object")
+		}
+		return tagOwners, nil
+	}
+
+	return nil, nil
+}
+
+// GetTagsFromHujson returns the names of every tag declared in `tagOwners`.
+func GetTagsFromHujson(input hujson.ValueTrimmed) ([]string, error) {
+	tagOwners, err := getTagOwnersObject(input)
+	if err != nil || tagOwners == nil {
+		return []string{}, err
+	}
+
+	tags := make([]string, 0, len(tagOwners.Members))
+	for _, member := range tagOwners.Members {
+		name, err := connutils.GetObjectMemberName(member)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, nil
+}
+
+// GetTagOwnersFromHujson returns the owners of a tag: users, groups,
+// autogroups and other tags.
+func GetTagOwnersFromHujson(input hujson.ValueTrimmed, tagName string) ([]string, error) {
+	tagOwnerList, err := findTagOwnersArray(input, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make([]string, 0, len(tagOwnerList.Elements))
+	for _, element := range tagOwnerList.Elements {
+		literal, ok := element.Value.(hujson.Literal)
+		if !ok {
+			continue
+		}
+		owners = append(owners, literal.String())
+	}
+	return owners, nil
+}
+
+func findTagOwnersArray(input hujson.ValueTrimmed, tagName string) (*hujson.Array, error) {
+	tagOwners, err := getTagOwnersObject(input)
+	if err != nil {
+		return nil, err
+	}
+	if tagOwners == nil {
+		return nil, errors.New("tagOwners not found")
+	}
+
+	for _, member := range tagOwners.Members {
+		name, err := connutils.GetObjectMemberName(member)
+		if err != nil {
+			return nil, err
+		}
+		if name != tagName {
+			continue
+		}
+
+		tagOwnerList, ok := member.Value.Value.(*hujson.Array)
+		if !ok {
+			return nil, errors.New("tag owner list was not an array")
+		}
+		return tagOwnerList, nil
+	}
+
+	return nil, errors.New("tag owner array not found")
+}
+
+// AddOwnerToTag adds a user email or group to the owners of a tag.
+func AddOwnerToTag(
+	ctx context.Context,
+	input *hujson.Value,
+	tagName string,
+	owner string,
+) (bool, error) {
+	tagOwnerList, err := findTagOwnersArray(input.Value, tagName)
+	if err != nil {
+		return false, err
+	}
+	defer input.Format()
+
+	owners := connutils.Convert(
+		tagOwnerList.Elements,
+		func(in hujson.Value) string {
+			lit, ok := in.Value.(hujson.Literal)
+			if !ok {
+				return ""
+			}
+			return lit.String()
+		},
+	)
+
+	if slices.Contains(owners, owner) {
+		return false, nil
+	}
+
+	tagOwnerList.Elements = append(
+		tagOwnerList.Elements,
+		hujson.ArrayElement{
+			Value: hujson.String(owner),
+		},
+	)
+
+	return true, nil
+}
+
+// RemoveOwnerFromTag removes a user email or group from the owners of a tag.
+func RemoveOwnerFromTag(
+	ctx context.Context,
+	input *hujson.Value,
+	tagName string,
+	owner string,
+) (bool, error) {
+	tagOwnerList, err := findTagOwnersArray(input.Value, tagName)
+	if err != nil {
+		return false, err
+	}
+
+	wasRemoved := false
+	for i := 0; i < len(tagOwnerList.Elements); i++ {
+		element := tagOwnerList.Elements[i]
+		literalOwner, ok := element.Value.(hujson.Literal)
+		if !ok {
+			return wasRemoved, errors.New("expected tag owner but wasn't a literal")
+		}
+
+		if literalOwner.String() == owner {
+			tagOwnerList.Elements = append(
+				tagOwnerList.Elements[:i],
+				tagOwnerList.Elements[i+1:]...,
+			)
+			wasRemoved = true
+			i--
+		}
+	}
+
+	input.Format()
+	return wasRemoved, nil
+}
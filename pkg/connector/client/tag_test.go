@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-tailscale/test"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/hujson"
+)
+
+func TestGetTagOwnersFromHujson(t *testing.T) {
+	val, err := hujson.Parse([]byte(test.MinimalTagOwnersExample))
+	require.Nil(t, err)
+
+	tags, err := GetTagsFromHujson(val.Value)
+	require.Nil(t, err)
+	require.Equal(t, []string{"tag:prod", "tag:ci"}, tags)
+
+	owners, err := GetTagOwnersFromHujson(val.Value, "tag:prod")
+	require.Nil(t, err)
+	require.Equal(t, []string{"group:devs", "john.degner@insulator.one"}, owners)
+
+	tags, err = GetTagsFromHujson(&hujson.Object{})
+	require.Nil(t, err)
+	require.Empty(t, tags)
+}
+
+func TestAddOwnerToTagHujson(t *testing.T) {
+	ctx := context.Background()
+	val, err := hujson.Parse([]byte(test.MinimalTagOwnersExample))
+	require.Nil(t, err)
+
+	wasAdded, err := AddOwnerToTag(ctx, &val, "tag:prod", "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.True(t, wasAdded)
+	require.Equal(t, test.ExpectedTagOwnersResult, val.String())
+
+	wasAdded, err = AddOwnerToTag(ctx, &val, "tag:prod", "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.False(t, wasAdded)
+}
+
+func TestRemoveOwnerFromTagHujson(t *testing.T) {
+	ctx := context.Background()
+	val, err := hujson.Parse([]byte(test.ExpectedTagOwnersResult))
+	require.Nil(t, err)
+
+	wasRemoved, err := RemoveOwnerFromTag(ctx, &val, "tag:prod", "bonk.flambe@insulator.one")
+	require.Nil(t, err)
+	require.True(t, wasRemoved)
+	require.Equal(t, test.MinimalTagOwnersExample, val.String())
+}
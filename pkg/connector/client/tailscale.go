@@ -3,35 +3,82 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/conductorone/baton-tailscale/pkg/connutils"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/tailscale/hujson"
 	"go.uber.org/zap"
 )
 
 const userAgent = "ConductorOne/tailscale-connector-0.2.0"
 
 type Client struct {
-	apiKey  string
-	tailnet string
-	baseUrl *url.URL
-	wrapper *uhttp.BaseHttpClient
+	readTokens  tokenSource
+	writeTokens tokenSource
+	tailnet     string
+	baseUrl     *url.URL
+	wrapper     *uhttp.BaseHttpClient
+	cache       *syncCache
+	// dryRun logs writes instead of sending them.
+	dryRun bool
+
+	// policyWriteMtx serializes writes of the policy file.
+	policyWriteMtx sync.Mutex
+	batch          policyBatch
+
+	policyMtx sync.Mutex
+	policy    *policySnapshot
+	store     *policyStore
 }
 
 // Documenting api calls
 // GET - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/users"
-// GET - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/devices
+// GET - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/devices?fields=all
 // GET - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/user-invites
+// POST - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/user-invites
+// GET - https://api.tailscale.com/api/v2/user-invites/__INVITEID__
+// DELETE - https://api.tailscale.com/api/v2/user-invites/__INVITEID__
+// POST - https://api.tailscale.com/api/v2/user-invites/__INVITEID__/resend
+// GET - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/keys/__KEYID__
+// GET - https://api.tailscale.com/api/v2/device/__DEVICEID__
+// POST - https://api.tailscale.com/api/v2/device/__DEVICEID__/tags
+// POST - https://api.tailscale.com/api/v2/device/__DEVICEID__/authorized
+// DELETE - https://api.tailscale.com/api/v2/device/__DEVICEID__
+// POST - https://api.tailscale.com/api/v2/device/__DEVICEID__/expire
+// POST - https://api.tailscale.com/api/v2/device/__DEVICEID__/key
+// GET - https://api.tailscale.com/api/v2/users/__USERID__
 // POST - https://api.tailscale.com/api/v2/users/__USERID__/role
-
-// New creates a new client.
-func New(ctx context.Context, apiKey string, tailnet string) (*Client, error) {
+// POST - https://api.tailscale.com/api/v2/users/__USERID__/suspend
+// POST - https://api.tailscale.com/api/v2/users/__USERID__/restore
+// POST - https://api.tailscale.com/api/v2/users/__USERID__/delete
+// POST - https://api.tailscale.com/api/v2/tailnet/__TAILNETID__/acl/validate
+// POST - https://api.tailscale.com/api/v2/oauth/token
+
+// New creates a new client. Reads use credentials and writes use
+// writeCredentials. When writeCredentials is empty the client is read-only.
+// With shareResponses, responses are shared between the resource builders
+// until the sync cache is cleared. With dryRun, writes are logged as the
+// request they would have sent, and policy file edits are validated and
+// reported as a diff, but nothing is changed. With a policyCacheDir, the
+// policy file and what is listed from it are kept there between runs.
+func New(
+	ctx context.Context,
+	credentials Credentials,
+	writeCredentials Credentials,
+	tailnet string,
+	shareResponses bool,
+	dryRun bool,
+	policyCacheDir string,
+) (*Client, error) {
 	httpClient, err := uhttp.NewClient(
 		ctx,
 		uhttp.WithLogger(true, ctxzap.Extract(ctx)),
@@ -50,30 +97,87 @@ func New(ctx context.Context, apiKey string, tailnet string) (*Client, error) {
 		return nil, err
 	}
 
+	readTokens, err := newTokenSource(credentials, wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	var writeTokens tokenSource
+	if !writeCredentials.IsZero() {
+		writeTokens, err = newTokenSource(writeCredentials, wrapper)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var cache *syncCache
+	if shareResponses {
+		cache = newSyncCache()
+	}
+
+	store := newPolicyStore(policyCacheDir, tailnet)
+	policy, err := store.load()
+	if err != nil {
+		// The stored policy file only saves work, so the next read starts over.
+		ctxzap.Extract(ctx).Warn("tailscale-connector: failed to load stored policy file", zap.Error(err))
+		policy = nil
+	}
+
 	return &Client{
-		apiKey:  apiKey,
-		tailnet: tailnet,
-		baseUrl: url,
-		wrapper: wrapper,
+		readTokens:  readTokens,
+		writeTokens: writeTokens,
+		tailnet:     tailnet,
+		baseUrl:     url,
+		wrapper:     wrapper,
+		cache:       cache,
+		dryRun:      dryRun,
+		policy:      policy,
+		store:       store,
 	}, nil
 }
 
-func (c *Client) ListGroups(ctx context.Context) ([]Resource, *v2.RateLimitDescription, error) {
-	response, _, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return nil, ratelimitData, err
+// ClearSyncCache drops the responses shared so far. Call it when a sync starts.
+func (c *Client) ClearSyncCache() {
+	c.cache.clear()
+}
+
+// CanWrite reports whether provisioning is enabled: a write credential was
+// configured, or writes are only logged in dry-run mode.
+func (c *Client) CanWrite() bool {
+	return c.writeTokens != nil || c.dryRun
+}
+
+func (c *Client) readToken(ctx context.Context) (string, error) {
+	return c.readTokens.Token(ctx)
+}
+
+// writeToken returns a token of the write credential. In dry-run mode,
+// where nothing is written, the read credential stands in for a missing one.
+func (c *Client) writeToken(ctx context.Context) (string, error) {
+	if c.writeTokens == nil {
+		if c.dryRun {
+			return c.readToken(ctx)
+		}
+		return "", ErrReadOnly
 	}
+	return c.writeTokens.Token(ctx)
+}
 
+func (c *Client) ListGroups(ctx context.Context) ([]Resource, *v2.RateLimitDescription, error) {
+	return listFromPolicy(ctx, c, "groups", groupsFromPolicy)
+}
+
+func groupsFromPolicy(response *hujson.Value) ([]Resource, error) {
 	groupNames := connutils.Unique(
 		connutils.Convert(
 			connutils.GetPatternFromHujson(
 				response.Value,
 				func(s string) bool {
-					return strings.HasPrefix(s, groupPrefix)
+					return strings.HasPrefix(s, GroupPrefix)
 				},
 			),
 			func(s string) string {
-				return strings.TrimPrefix(s, groupPrefix)
+				return strings.TrimPrefix(s, GroupPrefix)
 			},
 		),
 	)
@@ -83,58 +187,66 @@ func (c *Client) ListGroups(ctx context.Context) ([]Resource, *v2.RateLimitDescr
 			groups,
 			Resource{
 				DisplayName: groupName,
-				Id:          groupPrefix + groupName,
+				Id:          GroupPrefix + groupName,
 			},
 		)
 	}
 
-	return groups, ratelimitData, nil
+	return groups, nil
 }
 
-func (c *Client) AddEmailToGroup(ctx context.Context, groupName string, email string) (bool, *v2.RateLimitDescription, error) {
-	response, etag, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return false, ratelimitData, err
-	}
-
-	wasAdded, err := AddEmailToGroup(ctx, response, groupName, email)
-	if err != nil {
-		return false, nil, err
-	}
-
-	if !wasAdded {
-		return false, ratelimitData, nil
-	}
+func (c *Client) AddEmailToGroup(ctx context.Context, groupName string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return AddEmailToGroup(ctx, response, groupName, email)
+	})
+}
 
-	response.Format()
-	// hujson payload bytes
-	postBody := response.Pack()
-	_, ratelimitData, err = c.post(ctx, postBody, etag)
+func (c *Client) RemoveEmailFromGroup(ctx context.Context, groupName string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return RemoveEmailFromGroup(ctx, response, groupName, email)
+	})
+}
 
-	return true, ratelimitData, err
+func (c *Client) ListTags(ctx context.Context) ([]Resource, *v2.RateLimitDescription, error) {
+	return listFromPolicy(ctx, c, "tags", tagsFromPolicy)
 }
 
-func (c *Client) RemoveEmailFromGroup(ctx context.Context, groupName string, email string) (bool, *v2.RateLimitDescription, error) {
-	response, etag, ratelimitData, err := c.get(ctx)
+func tagsFromPolicy(response *hujson.Value) ([]Resource, error) {
+	tagNames, err := GetTagsFromHujson(response.Value)
 	if err != nil {
-		return false, ratelimitData, err
+		return nil, err
 	}
 
-	wasRemoved, err := RemoveEmailFromGroup(ctx, response, groupName, email)
-	if err != nil {
-		return false, nil, err
+	tags := make([]Resource, 0, len(tagNames))
+	for _, tagName := range tagNames {
+		tags = append(
+			tags,
+			Resource{
+				DisplayName: strings.TrimPrefix(tagName, tagPrefix),
+				Id:          tagName,
+			},
+		)
 	}
 
-	if !wasRemoved {
-		return false, ratelimitData, nil
-	}
+	return tags, nil
+}
+
+func (c *Client) ListTagOwners(ctx context.Context, tagName string) ([]string, *v2.RateLimitDescription, error) {
+	return listFromPolicy(ctx, c, "tag-owners:"+tagName, func(response *hujson.Value) ([]string, error) {
+		return GetTagOwnersFromHujson(response.Value, tagName)
+	})
+}
 
-	response.Format()
-	// hujson payload bytes
-	postBody := response.Pack()
-	_, ratelimitData, err = c.post(ctx, postBody, etag)
+func (c *Client) AddOwnerToTag(ctx context.Context, tagName string, owner string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return AddOwnerToTag(ctx, response, tagName, owner)
+	})
+}
 
-	return true, ratelimitData, err
+func (c *Client) RemoveOwnerFromTag(ctx context.Context, tagName string, owner string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return RemoveOwnerFromTag(ctx, response, tagName, owner)
+	})
 }
 
 func (c *Client) addEmailToRule(
@@ -144,38 +256,21 @@ func (c *Client) addEmailToRule(
 	hashPrefix string,
 	email string,
 ) (
-	bool,
+	*PolicyWriteResult,
 	*v2.RateLimitDescription,
 	error,
 ) {
-	response, etag, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return false, ratelimitData, err
-	}
-
 	hash := strings.TrimPrefix(ruleHash, fmt.Sprintf("%s:", hashPrefix))
-	wasAdded, err := AddEmailToRule(ctx, response, ruleKey, hash, email)
-	if err != nil {
-		return false, nil, err
-	}
-
-	if !wasAdded {
-		return false, ratelimitData, nil
-	}
-
-	response.Format()
-	// hujson payload bytes
-	postBody := response.Pack()
-	_, ratelimitData, err = c.post(ctx, postBody, etag)
-
-	return true, ratelimitData, err
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return AddEmailToRule(ctx, response, ruleKey, hash, email)
+	})
 }
 
-func (c *Client) AddEmailToSSHRule(ctx context.Context, ruleHash string, email string) (bool, *v2.RateLimitDescription, error) {
+func (c *Client) AddEmailToSSHRule(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
 	return c.addEmailToRule(ctx, ruleHash, RuleKeySSH, "ssh", email)
 }
 
-func (c *Client) AddEmailToACLRule(ctx context.Context, ruleHash string, email string) (bool, *v2.RateLimitDescription, error) {
+func (c *Client) AddEmailToACLRule(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
 	return c.addEmailToRule(ctx, ruleHash, RuleKeyACLs, "acl", email)
 }
 
@@ -186,51 +281,36 @@ func (c *Client) removeEmailFromRule(
 	hashPrefix string,
 	email string,
 ) (
-	bool,
+	*PolicyWriteResult,
 	*v2.RateLimitDescription,
 	error,
 ) {
-	response, etag, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return false, ratelimitData, err
-	}
-
 	hash := strings.TrimPrefix(ruleHash, fmt.Sprintf("%s:", hashPrefix))
-	wasRemoved, err := RemoveEmailFromRule(ctx, response, ruleKey, hash, email)
-	if err != nil {
-		return false, nil, err
-	}
-
-	if !wasRemoved {
-		return false, ratelimitData, nil
-	}
-
-	response.Format()
-	// hujson payload bytes
-	postBody := response.Pack()
-	_, ratelimitData, err = c.post(ctx, postBody, etag)
-
-	return true, ratelimitData, err
+	return c.mutatePolicy(ctx, func(ctx context.Context, response *hujson.Value) (bool, error) {
+		return RemoveEmailFromRule(ctx, response, ruleKey, hash, email)
+	})
 }
 
-func (c *Client) RemoveEmailFromSSHRule(ctx context.Context, ruleHash string, email string) (bool, *v2.RateLimitDescription, error) {
+func (c *Client) RemoveEmailFromSSHRule(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
 	return c.removeEmailFromRule(ctx, ruleHash, RuleKeySSH, "ssh", email)
 }
 
-func (c *Client) RemoveEmailFromACLRule(ctx context.Context, ruleHash string, email string) (bool, *v2.RateLimitDescription, error) {
+func (c *Client) RemoveEmailFromACLRule(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
 	return c.removeEmailFromRule(ctx, ruleHash, RuleKeyACLs, "acl", email)
 }
 
+func (c *Client) AddEmailToGrant(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.addEmailToRule(ctx, ruleHash, RuleKeyGrants, "grant", email)
+}
+
+func (c *Client) RemoveEmailFromGrant(ctx context.Context, ruleHash string, email string) (*PolicyWriteResult, *v2.RateLimitDescription, error) {
+	return c.removeEmailFromRule(ctx, ruleHash, RuleKeyGrants, "grant", email)
+}
+
 func (c *Client) ListGroupMemberships(ctx context.Context, groupName string) ([]string, *v2.RateLimitDescription, error) {
-	response, _, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return nil, ratelimitData, err
-	}
-	emails, err := GetGroupRulesFromHujson(response.Value, groupName)
-	if err != nil {
-		return nil, nil, err
-	}
-	return emails, ratelimitData, nil
+	return listFromPolicy(ctx, c, "group-members:"+groupName, func(response *hujson.Value) ([]string, error) {
+		return GetGroupRulesFromHujson(response.Value, groupName)
+	})
 }
 
 func (c *Client) listRules(ctx context.Context, key ruleKey, idPrefix string) ([]Resource, *v2.RateLimitDescription, error) {
@@ -241,18 +321,20 @@ func (c *Client) listRules(ctx context.Context, key ruleKey, idPrefix string) ([
 		zap.String("idPrefix", idPrefix),
 	)
 
-	target, _, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return nil, ratelimitData, err
-	}
+	return listFromPolicy(ctx, c, "rules:"+idPrefix, func(target *hujson.Value) ([]Resource, error) {
+		return rulesFromPolicy(target, key, idPrefix)
+	})
+}
 
+func rulesFromPolicy(target *hujson.Value, key ruleKey, idPrefix string) ([]Resource, error) {
 	rules, err := GetRulesFromHujson(target.Value, key)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
+	hashes := RuleHashes(rules, key)
 	output := make([]Resource, 0)
-	for _, foundRule := range rules {
+	for i, foundRule := range rules {
 		action := foundRule.GetValueOfNamedMember("action")[0]
 		dst := append(
 			foundRule.GetValueOfNamedMember("ports"),
@@ -260,13 +342,13 @@ func (c *Client) listRules(ctx context.Context, key ruleKey, idPrefix string) ([
 		)
 		name := connutils.Truncate(strings.Join(dst, ", "), 64)
 		newResource := Resource{
-			Id:          fmt.Sprintf("%s:%s", idPrefix, foundRule.GetHash()),
+			Id:          fmt.Sprintf("%s:%s", idPrefix, hashes[i]),
 			DisplayName: fmt.Sprintf("%s: %s", action, name),
 		}
 		output = append(output, newResource)
 	}
 
-	return output, ratelimitData, nil
+	return output, nil
 }
 
 func (c *Client) ListSSHRules(ctx context.Context) ([]Resource, *v2.RateLimitDescription, error) {
@@ -277,7 +359,60 @@ func (c *Client) ListACLRules(ctx context.Context) ([]Resource, *v2.RateLimitDes
 	return c.listRules(ctx, "acls", "acl")
 }
 
-func (c *Client) listRuleEmails(
+// ListGrants lists the rules of the policy file's `grants` section.
+// Unlike ACL and SSH rules, grants have no action, so they are named after
+// their destinations and the IP or app capabilities they grant.
+func (c *Client) ListGrants(ctx context.Context) ([]Resource, *v2.RateLimitDescription, error) {
+	return listFromPolicy(ctx, c, "grants", grantsFromPolicy)
+}
+
+func grantsFromPolicy(target *hujson.Value) ([]Resource, error) {
+	rules, err := GetRulesFromHujson(target.Value, RuleKeyGrants)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := RuleHashes(rules, RuleKeyGrants)
+	output := make([]Resource, 0)
+	for i, foundRule := range rules {
+		dst := connutils.Truncate(strings.Join(foundRule.GetValueOfNamedMember("dst"), ", "), 64)
+		granted := append(
+			foundRule.GetValueOfNamedMember("ip"),
+			foundRule.GetNamesOfObjectMember("app")...,
+		)
+		name := connutils.Truncate(strings.Join(granted, ", "), 64)
+		newResource := Resource{
+			Id:          fmt.Sprintf("grant:%s", hashes[i]),
+			DisplayName: fmt.Sprintf("%s: %s", dst, name),
+		}
+		output = append(output, newResource)
+	}
+
+	return output, nil
+}
+
+// ListGrantCapabilities returns the app capabilities, e.g. `tailscale.com/cap/kubernetes`, of a grant.
+func (c *Client) ListGrantCapabilities(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
+	return listFromPolicy(ctx, c, "grant-capabilities:"+ruleId, func(response *hujson.Value) ([]string, error) {
+		rules, err := GetRulesFromHujson(response.Value, RuleKeyGrants)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, hash := range RuleHashes(rules, RuleKeyGrants) {
+			if fmt.Sprintf("grant:%s", hash) == ruleId {
+				return rules[i].GetNamesOfObjectMember("app"), nil
+			}
+		}
+
+		return []string{}, nil
+	})
+}
+
+// listRuleSources returns the users, by email, and the `group:` and
+// `autogroup:` groups a rule applies to. Other sources, like hosts or tags,
+// are skipped.
+func (c *Client) listRuleSources(
 	ctx context.Context,
 	ruleId string,
 	key ruleKey,
@@ -287,43 +422,51 @@ func (c *Client) listRuleEmails(
 	*v2.RateLimitDescription,
 	error,
 ) {
-	response, _, ratelimitData, err := c.get(ctx)
-	if err != nil {
-		return nil, ratelimitData, err
-	}
-
-	rules, err := GetRulesFromHujson(response.Value, key)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	emails := make([]string, 0)
-	for _, foundRule := range rules {
-		hash := fmt.Sprintf("%s:%s", idPrefix, foundRule.GetHash())
-		if hash != ruleId {
-			continue
+	return listFromPolicy(ctx, c, "rule-sources:"+ruleId, func(response *hujson.Value) ([]string, error) {
+		rules, err := GetRulesFromHujson(response.Value, key)
+		if err != nil {
+			return nil, err
 		}
-		for _, email := range foundRule.GetValueOfNamedMember("src") {
-			if connutils.IsValidEmail(email) {
-				emails = append(emails, email)
+
+		hashes := RuleHashes(rules, key)
+		sources := make([]string, 0)
+		for i, foundRule := range rules {
+			hash := fmt.Sprintf("%s:%s", idPrefix, hashes[i])
+			if hash != ruleId {
+				continue
 			}
-		}
-		for _, email := range foundRule.GetValueOfNamedMember("users") {
-			if connutils.IsValidEmail(email) {
-				emails = append(emails, email)
+			for _, member := range []string{"src", "users"} {
+				if !isSourceMember(member, key) {
+					continue
+				}
+				for _, source := range foundRule.GetValueOfNamedMember(member) {
+					if isRuleSource(source) {
+						sources = append(sources, source)
+					}
+				}
 			}
 		}
-	}
 
-	return emails, ratelimitData, nil
+		return sources, nil
+	})
+}
+
+func isRuleSource(source string) bool {
+	return connutils.IsValidEmail(source) ||
+		strings.HasPrefix(source, GroupPrefix) ||
+		strings.HasPrefix(source, AutogroupPrefix)
 }
 
-func (c *Client) ListSSHEmails(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
-	return c.listRuleEmails(ctx, ruleId, "ssh", "ssh")
+func (c *Client) ListSSHSources(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
+	return c.listRuleSources(ctx, ruleId, "ssh", "ssh")
 }
 
-func (c *Client) ListACLEmails(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
-	return c.listRuleEmails(ctx, ruleId, "acls", "acl")
+func (c *Client) ListACLSources(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
+	return c.listRuleSources(ctx, ruleId, "acls", "acl")
+}
+
+func (c *Client) ListGrantSources(ctx context.Context, ruleId string) ([]string, *v2.RateLimitDescription, error) {
+	return c.listRuleSources(ctx, ruleId, RuleKeyGrants, "grant")
 }
 
 func WithAuthorizationBearerHeader(token string) uhttp.RequestOption {
@@ -331,27 +474,142 @@ func WithAuthorizationBearerHeader(token string) uhttp.RequestOption {
 }
 
 func (c *Client) doRequest(ctx context.Context, path string, target interface{}) (*v2.RateLimitDescription, error) {
+	return c.doGetRequest(ctx, c.baseUrl.JoinPath(path), target)
+}
+
+// doUncachedRequest is like doRequest but always hits the API. Use it for
+// reads that a write is computed from.
+func (c *Client) doUncachedRequest(ctx context.Context, path string, target interface{}) (*v2.RateLimitDescription, error) {
+	return c.doUncachedGetRequest(ctx, c.baseUrl.JoinPath(path), target)
+}
+
+// doGetRequest reads a JSON response, shared through the sync cache. The
+// http client's cache is always bypassed, so that the sync cache decides
+// alone how long a response is reused.
+func (c *Client) doGetRequest(ctx context.Context, uri *url.URL, target interface{}) (*v2.RateLimitDescription, error) {
+	key := http.MethodGet + " " + uri.String()
+	response, err := c.cache.do(ctx, key, func() (*cachedResponse, error) {
+		return c.getJSON(ctx, disableCache(uri))
+	})
+	if err != nil {
+		return response.ratelimit(), err
+	}
+
+	err = json.Unmarshal(response.body, target)
+	if err != nil {
+		return response.ratelimitData, fmt.Errorf("tailscale-connector: failed to unmarshal json response: %w", err)
+	}
+
+	return response.ratelimitData, nil
+}
+
+// doUncachedGetRequest reads a JSON response bypassing every cache.
+func (c *Client) doUncachedGetRequest(ctx context.Context, uri *url.URL, target interface{}) (*v2.RateLimitDescription, error) {
+	response, err := c.getJSON(ctx, disableCache(uri))
+	if err != nil {
+		return response.ratelimit(), err
+	}
+
+	err = json.Unmarshal(response.body, target)
+	if err != nil {
+		return response.ratelimitData, fmt.Errorf("tailscale-connector: failed to unmarshal json response: %w", err)
+	}
+
+	return response.ratelimitData, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, uri *url.URL) (*cachedResponse, error) {
+	token, err := c.readToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	request, err := c.wrapper.NewRequest(
 		ctx,
 		http.MethodGet,
-		c.baseUrl.JoinPath(path),
+		uri,
 		uhttp.WithAcceptJSONHeader(),
-		WithAuthorizationBearerHeader(c.apiKey),
+		WithAuthorizationBearerHeader(token),
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	var ratelimitData v2.RateLimitDescription
+	var body []byte
 	response, err := c.wrapper.Do(
 		request,
-		uhttp.WithJSONResponse(&target),
+		withJSONBody(&body),
 		uhttp.WithRatelimitData(&ratelimitData),
 	)
+	if err != nil {
+		return &cachedResponse{ratelimitData: &ratelimitData}, err
+	}
+
+	defer response.Body.Close()
+	return &cachedResponse{
+		body:          body,
+		etag:          response.Header.Get("etag"),
+		ratelimitData: &ratelimitData,
+	}, nil
+}
+
+// withJSONBody keeps the raw body of a JSON response.
+func withJSONBody(body *[]byte) uhttp.DoOption {
+	return func(response *uhttp.WrapperResponse) error {
+		responseContentType := response.Header.Get(uhttp.ContentType)
+		if !uhttp.IsJSONContentType(responseContentType) {
+			return fmt.Errorf("unexpected content type for json response: %s. status code: %d", responseContentType, response.StatusCode)
+		}
+		*body = response.Body
+		return nil
+	}
+}
+
+// doPostRequest posts body as JSON with the write credential. The body is
+// left empty and the response is not decoded when they are nil. In dry-run
+// mode the request is only logged.
+func (c *Client) doPostRequest(ctx context.Context, path string, body interface{}, target interface{}) (*v2.RateLimitDescription, error) {
+	token, err := c.writeToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requestOptions := []uhttp.RequestOption{
+		uhttp.WithAcceptJSONHeader(),
+		WithAuthorizationBearerHeader(token),
+	}
+	if body != nil {
+		requestOptions = append(requestOptions, uhttp.WithJSONBody(body))
+	}
+
+	if c.dryRun {
+		_, err = logDryRunRequest(ctx, http.MethodPost, c.baseUrl.JoinPath(path), body)
+		return nil, err
+	}
+
+	request, err := c.wrapper.NewRequest(
+		ctx,
+		http.MethodPost,
+		c.baseUrl.JoinPath(path),
+		requestOptions...,
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	var ratelimitData v2.RateLimitDescription
+	options := []uhttp.DoOption{uhttp.WithRatelimitData(&ratelimitData)}
+	if target != nil {
+		options = append(options, uhttp.WithJSONResponse(target))
+	}
+
+	response, err := c.wrapper.Do(request, options...)
+	c.cache.clear()
+	if err != nil {
+		return &ratelimitData, err
+	}
+
 	defer response.Body.Close()
 	return &ratelimitData, nil
 }
@@ -374,6 +632,124 @@ func (c *Client) GetUsers(ctx context.Context) ([]User, *v2.RateLimitDescription
 	return userData.Users, ratelimitData, nil
 }
 
+// doDeleteRequest sends a DELETE request with the write credential. In
+// dry-run mode the request is only logged.
+func (c *Client) doDeleteRequest(ctx context.Context, path string) (*v2.RateLimitDescription, error) {
+	token, err := c.writeToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.dryRun {
+		_, err = logDryRunRequest(ctx, http.MethodDelete, c.baseUrl.JoinPath(path), nil)
+		return nil, err
+	}
+
+	request, err := c.wrapper.NewRequest(
+		ctx,
+		http.MethodDelete,
+		c.baseUrl.JoinPath(path),
+		uhttp.WithAcceptJSONHeader(),
+		WithAuthorizationBearerHeader(token),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratelimitData v2.RateLimitDescription
+	response, err := c.wrapper.Do(
+		request,
+		uhttp.WithRatelimitData(&ratelimitData),
+	)
+	c.cache.clear()
+	if err != nil {
+		return &ratelimitData, err
+	}
+
+	defer response.Body.Close()
+	return &ratelimitData, nil
+}
+
+// GetUsersWithRole. Get the users holding a role. The response is never
+// cached, since role changes are checked against it.
+// https://tailscale.com/api#tag/users/GET/tailnet/{tailnet}/users
+func (c *Client) GetUsersWithRole(ctx context.Context, role string) ([]User, *v2.RateLimitDescription, error) {
+	var userData UsersAPIData
+	endpointUrl := c.baseUrl.JoinPath("tailnet", c.tailnet, "users")
+	query := endpointUrl.Query()
+	query.Set("role", role)
+	endpointUrl.RawQuery = query.Encode()
+
+	ratelimitData, err := c.doUncachedGetRequest(ctx, endpointUrl, &userData)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	return userData.Users, ratelimitData, nil
+}
+
+// GetUser. Get a single user. The response is never cached, so that it
+// reflects changes made by the connector.
+// https://tailscale.com/api#tag/users/GET/users/{userId}
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error) {
+	var user User
+	endpointUrl, err := url.JoinPath("users", userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := c.doUncachedRequest(ctx, endpointUrl, &user)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	return &user, ratelimitData, nil
+}
+
+// SuspendUser. Suspends a user. Suspended users cannot use the tailnet.
+// https://tailscale.com/api#tag/users/POST/users/{userId}/suspend
+func (c *Client) SuspendUser(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error) {
+	return c.changeUserStatus(ctx, userID, "suspend", "suspended")
+}
+
+// RestoreUser. Restores a suspended user.
+// https://tailscale.com/api#tag/users/POST/users/{userId}/restore
+func (c *Client) RestoreUser(ctx context.Context, userID string) (*User, *v2.RateLimitDescription, error) {
+	return c.changeUserStatus(ctx, userID, "restore", "active")
+}
+
+// changeUserStatus runs a user action that changes the user's status and
+// returns the user afterwards. The action responds without the user, so the
+// user is read again.
+func (c *Client) changeUserStatus(ctx context.Context, userID string, action string, status string) (*User, *v2.RateLimitDescription, error) {
+	ratelimitData, err := c.postUserAction(ctx, userID, action)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	if c.dryRun {
+		// The user is returned as the action would have left them.
+		return &User{ID: userID, Status: status}, ratelimitData, nil
+	}
+
+	return c.GetUser(ctx, userID)
+}
+
+// DeleteUser. Deletes a user and their devices from the tailnet.
+// https://tailscale.com/api#tag/users/POST/users/{userId}/delete
+func (c *Client) DeleteUser(ctx context.Context, userID string) (*v2.RateLimitDescription, error) {
+	return c.postUserAction(ctx, userID, "delete")
+}
+
+func (c *Client) postUserAction(ctx context.Context, userID string, action string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("users", userID, action)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doPostRequest(ctx, endpointUrl, nil, nil)
+}
+
 // GetUserInvites. Get all users invites. Only authenticated users may call this resource.
 // https://tailscale.com/api#tag/userinvites/GET/tailnet/{tailnet}/user-invites
 // The Tailscale API does not currently support pagination. All results are returned at once.
@@ -392,65 +768,331 @@ func (c *Client) GetUserInvites(ctx context.Context) (UserInvitesAPIData, *v2.Ra
 	return userInviteData, ratelimitData, nil
 }
 
+// GetUserInvite. Get a single user invite. The response is never cached, so
+// that it reflects changes made by the connector.
+// https://tailscale.com/api#tag/userinvites/GET/user-invites/{userInviteId}
+func (c *Client) GetUserInvite(ctx context.Context, inviteID string) (*UserInvite, *v2.RateLimitDescription, error) {
+	var userInvite UserInvite
+	endpointUrl, err := url.JoinPath("user-invites", inviteID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := c.doUncachedRequest(ctx, endpointUrl, &userInvite)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	return &userInvite, ratelimitData, nil
+}
+
+// DeleteUserInvite. Cancels a pending user invite.
+// https://tailscale.com/api#tag/userinvites/DELETE/user-invites/{userInviteId}
+func (c *Client) DeleteUserInvite(ctx context.Context, inviteID string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("user-invites", inviteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doDeleteRequest(ctx, endpointUrl)
+}
+
+// ResendUserInvite. Sends the email of a pending user invite again.
+// https://tailscale.com/api#tag/userinvites/POST/user-invites/{userInviteId}/resend
+func (c *Client) ResendUserInvite(ctx context.Context, inviteID string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("user-invites", inviteID, "resend")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doPostRequest(ctx, endpointUrl, nil, nil)
+}
+
+// CreateUserInvite. Invites a user to the tailnet with an initial role.
+// https://tailscale.com/api#tag/userinvites/POST/tailnet/{tailnet}/user-invites
+func (c *Client) CreateUserInvite(ctx context.Context, email string, role string) (*UserInvite, *v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("tailnet", c.tailnet, "user-invites")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := []struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}{
+		{Email: email, Role: role},
+	}
+
+	if c.dryRun {
+		// The invite does not exist until the request is sent.
+		request, err := logDryRunRequest(ctx, http.MethodPost, c.baseUrl.JoinPath(endpointUrl), body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, &DryRunError{Request: request}
+	}
+
+	var userInviteData UserInvitesAPIData
+	ratelimitData, err := c.doPostRequest(ctx, endpointUrl, body, &userInviteData)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	if len(userInviteData) == 0 {
+		return nil, ratelimitData, fmt.Errorf("tailscale-connector: no invite was created for %s", email)
+	}
+
+	return &userInviteData[0], ratelimitData, nil
+}
+
+// ReissueUserInvite changes the role of a pending invite. Invites cannot be
+// updated, so a new invite with the role is sent before the old one is
+// cancelled. Returns the new invite. In dry-run mode both requests are only
+// logged and the pending invite is returned.
+func (c *Client) ReissueUserInvite(ctx context.Context, userInvite *UserInvite, role string) (*UserInvite, *v2.RateLimitDescription, error) {
+	newInvite, ratelimitData, err := c.CreateUserInvite(ctx, userInvite.Email, role)
+	var dryRunErr *DryRunError
+	if errors.As(err, &dryRunErr) {
+		newInvite, err = userInvite, nil
+	}
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	ratelimitData, err = c.DeleteUserInvite(ctx, userInvite.ID)
+	if err != nil {
+		return nil, ratelimitData, fmt.Errorf(
+			"tailscale-connector: invite %s was sent, but invite %s could not be cancelled: %w",
+			newInvite.ID,
+			userInvite.ID,
+			err,
+		)
+	}
+
+	return newInvite, ratelimitData, nil
+}
+
 // GetDevices. Get all devices. Only authenticated users may call this resource.
 // https://tailscale.com/api#tag/devices/GET/tailnet/{tailnet}/devices
 // The Tailscale API does not currently support pagination. All results are returned at once.
 func (c *Client) GetDevices(ctx context.Context) ([]Device, *v2.RateLimitDescription, error) {
 	var deviceData DevicesAPIData
-	endpointUrl, err := url.JoinPath("tailnet", c.tailnet, "devices")
+	endpointUrl := c.baseUrl.JoinPath("tailnet", c.tailnet, "devices")
+	query := endpointUrl.Query()
+	// Routes and connectivity are only returned with all fields.
+	query.Set("fields", "all")
+	endpointUrl.RawQuery = query.Encode()
+
+	ratelimitData, err := c.doGetRequest(ctx, endpointUrl, &deviceData)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	return deviceData.Devices, ratelimitData, nil
+}
+
+// GetDevice. Get a single device. The response is never cached, since
+// tag changes are computed from it.
+// https://tailscale.com/api#tag/devices/GET/device/{deviceId}
+func (c *Client) GetDevice(ctx context.Context, deviceID string) (*Device, *v2.RateLimitDescription, error) {
+	var device Device
+	endpointUrl, err := url.JoinPath("device", deviceID)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	ratelimitData, err := c.doRequest(ctx, endpointUrl, &deviceData)
+	ratelimitData, err := c.doUncachedRequest(ctx, endpointUrl, &device)
 	if err != nil {
 		return nil, ratelimitData, err
 	}
 
-	return deviceData.Devices, ratelimitData, nil
+	return &device, ratelimitData, nil
 }
 
-// UpdateUserRole. Updates user-roles
-// https://tailscale.com/api#tag/users/POST/users/{userId}/role
-func (c *Client) UpdateUserRole(ctx context.Context, userId, roleName string) error {
-	var (
-		body struct {
-			Role string `json:"role"`
-		}
-		payload = []byte(fmt.Sprintf(`{"role": "%s"}`, roleName))
-	)
+// SetDeviceTags. Replaces all tags of a device.
+// https://tailscale.com/api#tag/devices/POST/device/{deviceId}/tags
+func (c *Client) SetDeviceTags(ctx context.Context, deviceID string, tags []string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("device", deviceID, "tags")
+	if err != nil {
+		return nil, err
+	}
 
-	endpointUrl, err := url.JoinPath(c.baseUrl.String(), "users", userId, "role")
+	body := struct {
+		Tags []string `json:"tags"`
+	}{
+		Tags: tags,
+	}
+
+	return c.doPostRequest(ctx, endpointUrl, body, nil)
+}
+
+// SetDeviceAuthorized. Approves a device, or revokes its approval, on
+// tailnets with device approval turned on.
+// https://tailscale.com/api#tag/devices/POST/device/{deviceId}/authorized
+func (c *Client) SetDeviceAuthorized(ctx context.Context, deviceID string, authorized bool) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("device", deviceID, "authorized")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	body := struct {
+		Authorized bool `json:"authorized"`
+	}{
+		Authorized: authorized,
 	}
 
-	uri, err := url.Parse(endpointUrl)
+	return c.doPostRequest(ctx, endpointUrl, body, nil)
+}
+
+// DeleteDevice. Removes a device from the tailnet.
+// https://tailscale.com/api#tag/devices/DELETE/device/{deviceId}
+func (c *Client) DeleteDevice(ctx context.Context, deviceID string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("device", deviceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = json.Unmarshal(payload, &body)
+	return c.doDeleteRequest(ctx, endpointUrl)
+}
+
+// ExpireDeviceKey. Expires the node key of a device immediately, so that it
+// has to re-authenticate.
+// https://tailscale.com/api#tag/devices/POST/device/{deviceId}/expire
+func (c *Client) ExpireDeviceKey(ctx context.Context, deviceID string) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("device", deviceID, "expire")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req, err := c.wrapper.NewRequest(ctx,
-		http.MethodPost,
-		uri,
-		uhttp.WithAcceptJSONHeader(),
-		WithAuthorizationBearerHeader(c.apiKey),
-		uhttp.WithJSONBody(body),
-	)
+	return c.doPostRequest(ctx, endpointUrl, nil, nil)
+}
+
+// SetDeviceKeyExpiryDisabled. Turns key expiry of a device off or on.
+// https://tailscale.com/api#tag/devices/POST/device/{deviceId}/key
+func (c *Client) SetDeviceKeyExpiryDisabled(ctx context.Context, deviceID string, keyExpiryDisabled bool) (*v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("device", deviceID, "key")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := c.wrapper.Do(req)
+	body := struct {
+		KeyExpiryDisabled bool `json:"keyExpiryDisabled"`
+	}{
+		KeyExpiryDisabled: keyExpiryDisabled,
+	}
+
+	return c.doPostRequest(ctx, endpointUrl, body, nil)
+}
+
+// AddTagToDevice applies a tag to a device and keeps its other tags.
+// Returns false if the device already had the tag.
+func (c *Client) AddTagToDevice(ctx context.Context, deviceID string, tag string) (bool, *v2.RateLimitDescription, error) {
+	device, ratelimitData, err := c.GetDevice(ctx, deviceID)
+	if err != nil {
+		return false, ratelimitData, err
+	}
+
+	if slices.Contains(device.Tags, tag) {
+		return false, ratelimitData, nil
+	}
+
+	ratelimitData, err = c.SetDeviceTags(ctx, deviceID, append(device.Tags, tag))
 	if err != nil {
-		return err
+		return false, ratelimitData, err
+	}
+
+	return true, ratelimitData, nil
+}
+
+// RemoveTagFromDevice removes a tag from a device and keeps its other tags.
+// Returns false if the device did not have the tag.
+func (c *Client) RemoveTagFromDevice(ctx context.Context, deviceID string, tag string) (bool, *v2.RateLimitDescription, error) {
+	device, ratelimitData, err := c.GetDevice(ctx, deviceID)
+	if err != nil {
+		return false, ratelimitData, err
+	}
+
+	if !slices.Contains(device.Tags, tag) {
+		return false, ratelimitData, nil
+	}
+
+	tags := slices.DeleteFunc(slices.Clone(device.Tags), func(t string) bool {
+		return t == tag
+	})
+
+	ratelimitData, err = c.SetDeviceTags(ctx, deviceID, tags)
+	if err != nil {
+		return false, ratelimitData, err
+	}
+
+	return true, ratelimitData, nil
+}
+
+// GetPolicyFile. Get the tailnet policy file.
+// https://tailscale.com/api#tag/policyfile/GET/tailnet/{tailnet}/acl
+func (c *Client) GetPolicyFile(ctx context.Context) (*hujson.Value, *v2.RateLimitDescription, error) {
+	response, _, ratelimitData, err := c.get(ctx)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+	return response, ratelimitData, nil
+}
+
+// GetKey. Get a single key of the tailnet.
+// https://tailscale.com/api#tag/keys/GET/tailnet/{tailnet}/keys/{keyId}
+func (c *Client) GetKey(ctx context.Context, keyID string) (*Key, *v2.RateLimitDescription, error) {
+	var key Key
+	endpointUrl, err := url.JoinPath("tailnet", c.tailnet, "keys", keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := c.doRequest(ctx, endpointUrl, &key)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	return &key, ratelimitData, nil
+}
+
+// APIKeyIDs returns the IDs of the configured API access tokens.
+// OAuth clients do not expire, so they are not included.
+func (c *Client) APIKeyIDs() []string {
+	keyIDs := make([]string, 0)
+	for _, tokens := range []tokenSource{c.readTokens, c.writeTokens} {
+		apiKey, ok := tokens.(apiKeyTokenSource)
+		if !ok || apiKey.keyID() == "" {
+			continue
+		}
+		keyIDs = append(keyIDs, apiKey.keyID())
+	}
+	return connutils.Unique(keyIDs)
+}
+
+// UpdateUserRole. Updates the role of a user and returns the updated user.
+// https://tailscale.com/api#tag/users/POST/users/{userId}/role
+func (c *Client) UpdateUserRole(ctx context.Context, userId, roleName string) (*User, *v2.RateLimitDescription, error) {
+	endpointUrl, err := url.JoinPath("users", userId, "role")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := struct {
+		Role string `json:"role"`
+	}{
+		Role: roleName,
+	}
+
+	// The endpoint responds without the user, so the user is read again.
+	ratelimitData, err := c.doPostRequest(ctx, endpointUrl, body, nil)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	if c.dryRun {
+		// The user is returned as the update would have left them.
+		return &User{ID: userId, Role: roleName}, ratelimitData, nil
 	}
 
-	defer resp.Body.Close()
-	return nil
+	return c.GetUser(ctx, userId)
 }
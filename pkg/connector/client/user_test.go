@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUserRole(t *testing.T) {
+	ctx := context.Background()
+
+	role := "member"
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			assert.Equal(t, "/users/12345/role", r.URL.Path)
+
+			var body map[string]string
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, map[string]string{"role": "it-admin"}, body)
+			// The endpoint responds without a body.
+			role = body["role"]
+		case http.MethodGet:
+			assert.Equal(t, "/users/12345", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			assert.Nil(t, json.NewEncoder(w).Encode(User{ID: "12345", Role: role}))
+		}
+	}))
+
+	user, _, err := c.UpdateUserRole(ctx, "12345", "it-admin")
+	require.Nil(t, err)
+	require.Equal(t, "12345", user.ID)
+	require.Equal(t, "it-admin", user.Role)
+}
+
+func TestGetUsersWithRole(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tailnet/example.com/users", r.URL.Path)
+		assert.Equal(t, "owner", r.URL.Query().Get("role"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"users": [{"id": "1", "role": "owner"}]}`))
+	}))
+
+	users, _, err := c.GetUsersWithRole(ctx, "owner")
+	require.Nil(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "1", users[0].ID)
+}
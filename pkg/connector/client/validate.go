@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+const apiPathACLValidate = "/tailnet/%s/acl/validate"
+
+// PolicyValidation is the output of validating a policy file, including
+// the results of its `tests` and `sshTests`. It is empty when the policy
+// file is valid and all tests pass.
+type PolicyValidation struct {
+	Message string                  `json:"message,omitempty"`
+	Data    []PolicyValidationEntry `json:"data,omitempty"`
+}
+
+// PolicyValidationEntry lists the errors and warnings of the tests of one user.
+type PolicyValidationEntry struct {
+	User     string   `json:"user,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Failed reports whether the policy file was rejected. Warnings alone do
+// not reject a policy file.
+func (v *PolicyValidation) Failed() bool {
+	if v.Message != "" {
+		return true
+	}
+	for _, entry := range v.Data {
+		if len(entry.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyValidationError is returned when a policy file edit was not
+// committed because the resulting policy file failed validation.
+type PolicyValidationError struct {
+	Validation *PolicyValidation
+}
+
+func (e *PolicyValidationError) Error() string {
+	failures := make([]string, 0, len(e.Validation.Data))
+	for _, entry := range e.Validation.Data {
+		if len(entry.Errors) == 0 {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", entry.User, strings.Join(entry.Errors, ", ")))
+	}
+
+	message := e.Validation.Message
+	if message == "" {
+		message = "policy tests failed"
+	}
+	if len(failures) == 0 {
+		return fmt.Sprintf("tailscale-connector: policy file edit failed validation: %s", message)
+	}
+	return fmt.Sprintf("tailscale-connector: policy file edit failed validation: %s: %s", message, strings.Join(failures, "; "))
+}
+
+// ValidatePolicy checks a candidate policy file and runs its tests without
+// applying it.
+// https://tailscale.com/api#tag/policyfile/POST/tailnet/{tailnet}/acl/validate
+func (c *Client) ValidatePolicy(ctx context.Context, policy []byte) (*PolicyValidation, *v2.RateLimitDescription, error) {
+	token, err := c.writeToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err := c.wrapper.NewRequest(
+		ctx,
+		http.MethodPost,
+		c.baseUrl.JoinPath(fmt.Sprintf(apiPathACLValidate, c.tailnet)),
+		uhttp.WithAcceptJSONHeader(),
+		uhttp.WithContentType(contentType),
+		WithAuthorizationBearerHeader(token),
+		uhttp.WithBody(policy),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var validation PolicyValidation
+	var ratelimitData v2.RateLimitDescription
+	response, err := c.wrapper.Do(
+		request,
+		uhttp.WithJSONResponse(&validation),
+		uhttp.WithRatelimitData(&ratelimitData),
+	)
+	if err != nil {
+		// Policy files that cannot be parsed are rejected with a bad request.
+		if response != nil && response.StatusCode == http.StatusBadRequest && validation.Message != "" {
+			return &validation, &ratelimitData, nil
+		}
+		return nil, &ratelimitData, fmt.Errorf("tailscale-connector: failed to validate policy file: %w", err)
+	}
+
+	defer response.Body.Close()
+	return &validation, &ratelimitData, nil
+}
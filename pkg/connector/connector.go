@@ -2,29 +2,73 @@ package connector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+// keyExpiryWarning is how long before an API key expires Validate starts warning about it.
+const keyExpiryWarning = 14 * 24 * time.Hour
+
 type Connector struct {
-	client                 *client.Client
-	ignoreEphemeralDevices bool
+	client  *client.Client
+	tailnet string
+	devices *deviceFilter
+}
+
+// readOnlySyncer hides the provisioning methods of a resource syncer, so that
+// provisioning capabilities are not advertised without a write credential,
+// unless writes are only logged in dry-run mode.
+type readOnlySyncer struct {
+	connectorbuilder.ResourceSyncer
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
+	syncers := []connectorbuilder.ResourceSyncer{
 		newACLRuleBuilder(d.client),
 		newGroupBuilder(d.client),
+		newAutogroupBuilder(d.client),
 		newSSHRuleBuilder(d.client),
+		newGrantRuleBuilder(d.client),
+		newTagBuilder(d.client, d.devices),
 		newUserBuilder(d.client),
+		newInviteBuilder(d.client),
 		newRoleBuilder(d.client),
-		newDeviceBuilder(d.client, d.ignoreEphemeralDevices),
+		newDeviceBuilder(d.client, d.devices),
+	}
+
+	if !d.client.CanWrite() {
+		for i, syncer := range syncers {
+			syncers[i] = readOnlySyncer{syncer}
+		}
+	}
+
+	return syncers
+}
+
+// RegisterActionManager registers the custom actions of the resource builders.
+// Actions change the tailnet, so none are registered without a write credential
+// outside dry-run mode.
+func (d *Connector) RegisterActionManager(_ context.Context) (connectorbuilder.CustomActionManager, error) {
+	manager := newActionManager()
+	if d.client.CanWrite() {
+		newUserBuilder(d.client).registerActions(manager)
+		newInviteBuilder(d.client).registerActions(manager)
+		newDeviceBuilder(d.client, d.devices).registerActions(manager)
 	}
+	return manager, nil
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
@@ -38,23 +82,187 @@ func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 	return &v2.ConnectorMetadata{
 		DisplayName: "Tailscale Connector",
 		Description: "Connector Syncing Tailscale users, groups, and roles",
+		AccountCreationSchema: &v2.ConnectorAccountCreationSchema{
+			FieldMap: map[string]*v2.ConnectorAccountCreationSchema_Field{
+				"email": {
+					DisplayName: "Email",
+					Required:    true,
+					Description: "The email address the invite is sent to.",
+					Placeholder: "user@example.com",
+					Order:       1,
+					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+						StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+					},
+				},
+				"role": {
+					DisplayName: "Role",
+					Required:    false,
+					Description: "The role the user holds once the invite is accepted.",
+					Placeholder: defaultRole,
+					Order:       2,
+					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+						StringField: &v2.ConnectorAccountCreationSchema_StringField{
+							DefaultValue: proto.String(defaultRole),
+						},
+					},
+				},
+			},
+		},
 	}, nil
 }
 
+// validationCheck exercises a single API endpoint the connector syncs from.
+type validationCheck struct {
+	name  string
+	scope string
+	call  func(ctx context.Context) error
+}
+
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
 // to be sure that they are valid.
 func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	// Validate runs at the start of every sync, so responses shared with the
+	// previous sync are dropped here.
+	d.client.ClearSyncCache()
+
+	checks := []validationCheck{
+		{
+			name:  "users",
+			scope: "users:read",
+			call: func(ctx context.Context) error {
+				_, _, err := d.client.GetUsers(ctx)
+				return err
+			},
+		},
+		{
+			name:  "devices",
+			scope: "devices:core:read",
+			call: func(ctx context.Context) error {
+				_, _, err := d.client.GetDevices(ctx)
+				return err
+			},
+		},
+		{
+			name:  "policy_file",
+			scope: "policy_file:read",
+			call: func(ctx context.Context) error {
+				_, _, err := d.client.GetPolicyFile(ctx)
+				return err
+			},
+		},
+	}
+
+	reachable := make([]string, 0, len(checks))
+	var errs []error
+	for _, check := range checks {
+		err := check.call(ctx)
+		if err != nil {
+			errs = append(errs, d.validationError(check, err))
+			continue
+		}
+		reachable = append(reachable, check.name)
+	}
+
+	l.Info(
+		"tailscale-connector: validated tailscale api access",
+		zap.String("tailnet", d.tailnet),
+		zap.Strings("reachable", reachable),
+	)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	d.warnOnExpiringKeys(ctx)
+
 	return nil, nil
 }
 
+func (d *Connector) validationError(check validationCheck, err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf(
+			"tailscale-connector: tailnet %q not found while reading %s, check the configured tailnet name: %w",
+			d.tailnet,
+			check.name,
+			err,
+		)
+	case codes.Unauthenticated:
+		return fmt.Errorf(
+			"tailscale-connector: unauthorized while reading %s, check that the API key or OAuth client is valid and has not been revoked or expired: %w",
+			check.name,
+			err,
+		)
+	case codes.PermissionDenied:
+		return fmt.Errorf(
+			"tailscale-connector: missing scope for %s, the credential needs the %s scope: %w",
+			check.name,
+			check.scope,
+			err,
+		)
+	default:
+		return fmt.Errorf("tailscale-connector: failed to read %s: %w", check.name, err)
+	}
+}
+
+// warnOnExpiringKeys logs a warning for every configured API key that expires soon.
+// Failing to read a key is not fatal, since the key itself was already exercised.
+func (d *Connector) warnOnExpiringKeys(ctx context.Context) {
+	l := ctxzap.Extract(ctx)
+	for _, keyID := range d.client.APIKeyIDs() {
+		key, _, err := d.client.GetKey(ctx, keyID)
+		if err != nil {
+			l.Debug(
+				"tailscale-connector: could not read api key expiry",
+				zap.String("key_id", keyID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if key.Expires.IsZero() || time.Until(key.Expires) > keyExpiryWarning {
+			continue
+		}
+
+		l.Warn(
+			"tailscale-connector: api key expires soon, rotate it or switch to an OAuth client",
+			zap.String("key_id", keyID),
+			zap.Time("expires", key.Expires),
+			zap.Int("days_left", int(time.Until(key.Expires).Hours()/24)),
+		)
+	}
+}
+
 // New returns a new instance of the connector.
-func New(ctx context.Context, apiKey string, tailnet string, ignoreEphemeralDevices bool) (*Connector, error) {
-	client, err := client.New(ctx, apiKey, tailnet)
+func New(
+	ctx context.Context,
+	credentials client.Credentials,
+	writeCredentials client.Credentials,
+	tailnet string,
+	deviceFilter DeviceFilter,
+	disableSyncCache bool,
+	dryRun bool,
+	policyCacheDir string,
+) (*Connector, error) {
+	devices, err := newDeviceFilter(deviceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := client.New(ctx, credentials, writeCredentials, tailnet, !disableSyncCache, dryRun, policyCacheDir)
 	if err != nil {
 		return nil, err
 	}
+
+	if dryRun {
+		ctxzap.Extract(ctx).Info("tailscale-connector: dry run, provisioning changes are logged but not made")
+	} else if !client.CanWrite() {
+		ctxzap.Extract(ctx).Info("tailscale-connector: no write credential configured, provisioning is disabled")
+	}
 	return &Connector{
-		client:                 client,
-		ignoreEphemeralDevices: ignoreEphemeralDevices,
+		client:  client,
+		tailnet: tailnet,
+		devices: devices,
 	}, nil
 }
@@ -2,18 +2,46 @@ package connector
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 
+	configV1 "github.com/conductorone/baton-sdk/pb/c1/config/v1"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+const (
+	deviceOwnerEntitlement      = "owner"
+	deviceAuthorizedEntitlement = "authorized"
+
+	expireDeviceKeyAction     = "expire_device_key"
+	setDeviceKeyExpiryAction  = "set_device_key_expiry"
+	deviceIDArgument          = "device_id"
+	keyExpiryDisabledArgument = "key_expiry_disabled"
+	deviceKeyExpiresResponse  = "expires"
+)
+
+var deviceKeyReturnTypes = []*configV1.Field{
+	stringActionField(deviceIDArgument, "Device ID", "The ID of the device.", true),
+	stringActionField(deviceKeyExpiresResponse, "Expires", "When the node key of the device expires, empty if it does not.", false),
+	boolActionField(keyExpiryDisabledArgument, "Key Expiry Disabled", "Whether key expiry is turned off for the device.", true),
+}
+
 type deviceBuilder struct {
-	resourceType           *v2.ResourceType
-	client                 *client.Client
-	ignoreEphemeralDevices bool
+	resourceType *v2.ResourceType
+	client       *client.Client
+	filter       *deviceFilter
 }
 
 func (d *deviceBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -27,34 +55,71 @@ func deviceResource(ctx context.Context, device *client.Device, parentResourceID
 		device.ID,
 		rs.WithParentResourceID(parentResourceID),
 		rs.WithAppTrait(
-			rs.WithAppProfile(
-				map[string]interface{}{
-					"device_id":   device.ID,
-					"device_name": device.Name,
-					"login":       device.User,
-					"email":       device.User,
-					"authorized":  device.Authorized,
-				},
-			),
+			rs.WithAppProfile(deviceProfile(device, time.Now())),
 		),
 	)
 }
 
+// deviceProfile describes a device for hygiene reviews. Besides what the API
+// reports, it derives how many days are left until the node key expires and
+// since when a device that is offline was last seen.
+func deviceProfile(device *client.Device, now time.Time) map[string]interface{} {
+	profile := map[string]interface{}{
+		"device_id":                   device.ID,
+		"device_name":                 device.Name,
+		"login":                       device.User,
+		"email":                       device.User,
+		"authorized":                  device.Authorized,
+		"hostname":                    device.Hostname,
+		"os":                          device.Os,
+		"client_version":              device.ClientVersion,
+		"update_available":            device.UpdateAvailable,
+		"key_expiry_disabled":         device.KeyExpiryDisabled,
+		"is_external":                 device.IsExternal,
+		"is_ephemeral":                device.IsEphemeral,
+		"blocks_incoming_connections": device.BlocksIncomingConnections,
+		"connected_to_control":        device.ConnectedToControl,
+		"addresses":                   strings.Join(device.Addresses, ","),
+		"advertised_routes":           strings.Join(device.AdvertisedRoutes, ","),
+		"enabled_routes":              strings.Join(device.EnabledRoutes, ","),
+		"tags":                        strings.Join(device.Tags, ","),
+	}
+	if device.TailnetLockKey != "" {
+		profile["tailnet_lock_key"] = device.TailnetLockKey
+	}
+	if device.TailnetLockError != "" {
+		profile["tailnet_lock_error"] = device.TailnetLockError
+	}
+	if !device.Created.IsZero() {
+		profile["created"] = device.Created.Format(time.RFC3339)
+	}
+	if !device.Expires.IsZero() {
+		profile["expires"] = device.Expires.Format(time.RFC3339)
+		if !device.KeyExpiryDisabled {
+			// Negative once the key has expired.
+			profile["key_expires_in_days"] = int64(math.Floor(device.Expires.Sub(now).Hours() / 24))
+		}
+	}
+	if !device.LastSeen.IsZero() {
+		profile["last_seen"] = device.LastSeen.Format(time.RFC3339)
+		if !device.ConnectedToControl {
+			profile["stale_since"] = device.LastSeen.Format(time.RFC3339)
+			profile["stale_days"] = int64(now.Sub(device.LastSeen).Hours() / 24)
+		}
+	}
+
+	return profile
+}
+
 func (d *deviceBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	var rv []*v2.Resource
-	devices, _, err := d.client.GetDevices(ctx)
+	devices, _, err := d.filter.listDevices(ctx, d.client)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
 	for _, device := range devices {
 		deviceCopy := device
-
-		// Skip ephemeral devices if configured to ignore them
-		if d.ignoreEphemeralDevices && deviceCopy.IsEphemeral {
-			continue
-		}
-
 		dr, err := deviceResource(ctx, &deviceCopy, parentResourceID)
 		if err != nil {
 			return nil, "", nil, err
@@ -67,17 +132,234 @@ func (d *deviceBuilder) List(ctx context.Context, parentResourceID *v2.ResourceI
 }
 
 func (d *deviceBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(
+			resource,
+			deviceOwnerEntitlement,
+			ent.WithGrantableTo(userResourceType, tagResourceType),
+			ent.WithDisplayName(fmt.Sprintf("%s Device Owner", resource.DisplayName)),
+			ent.WithDescription(fmt.Sprintf("Owns the %s device in Tailscale", resource.DisplayName)),
+		),
+		ent.NewPermissionEntitlement(
+			resource,
+			deviceAuthorizedEntitlement,
+			ent.WithGrantableTo(deviceResourceType),
+			ent.WithDisplayName(fmt.Sprintf("%s Device Authorized", resource.DisplayName)),
+			ent.WithDescription(fmt.Sprintf("The %s device is approved to connect to the tailnet", resource.DisplayName)),
+		),
+	}, "", nil, nil
 }
 
+// Grants links a device to its owner. Tagged devices are owned by their tags
+// rather than by the user who registered them.
+// https://tailscale.com/kb/1068/tags
 func (d *deviceBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	device, err := deviceFromProfile(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	users, ratelimitData, err := d.client.GetUsers(ctx)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	rv := deviceOwnerGrants(resource, device, users)
+	if device.Authorized {
+		rv = append(rv, grant.NewGrant(resource, deviceAuthorizedEntitlement, resource.Id))
+	}
+
+	return rv, "", outputAnnotations, nil
+}
+
+// deviceFromProfile reads the fields grants are derived from back from the
+// profile of a device resource, so that the devices are not listed again for
+// every device.
+func deviceFromProfile(resource *v2.Resource) (*client.Device, error) {
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, err
+	}
+	profile := appTrait.GetProfile()
+
+	device := &client.Device{
+		ID:         resource.Id.Resource,
+		Authorized: profile.GetFields()["authorized"].GetBoolValue(),
+	}
+	device.User, _ = rs.GetProfileStringValue(profile, "login")
+	if tags, ok := rs.GetProfileStringValue(profile, "tags"); ok && tags != "" {
+		device.Tags = strings.Split(tags, ",")
+	}
+
+	return device, nil
+}
+
+// Grant authorizes a device. The authorized entitlement is granted to the
+// device itself.
+func (d *deviceBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	return d.setAuthorized(ctx, principal, entitlement, true)
+}
+
+// Revoke removes the authorization of a device.
+func (d *deviceBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	return d.setAuthorized(ctx, grant.Principal, grant.Entitlement, false)
+}
+
+func (d *deviceBuilder) setAuthorized(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+	authorized bool,
+) (annotations.Annotations, error) {
+	if entitlement.Slug != deviceAuthorizedEntitlement {
+		return nil, fmt.Errorf("tailscale-connector: the %s entitlement of devices cannot be provisioned", entitlement.Slug)
+	}
+	if principal.Id.ResourceType != deviceResourceType.Id || principal.Id.Resource != entitlement.Resource.Id.Resource {
+		return nil, fmt.Errorf("tailscale-connector: only the device itself can be authorized")
+	}
+
+	deviceID := principal.Id.Resource
+	device, ratelimitData, err := d.client.GetDevice(ctx, deviceID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to get device: %w", err)
+	}
+
+	if device.Authorized == authorized {
+		if authorized {
+			outputAnnotations.Append(&v2.GrantAlreadyExists{})
+		} else {
+			outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+		}
+		return outputAnnotations, nil
+	}
+
+	ratelimitData, err = d.client.SetDeviceAuthorized(ctx, deviceID, authorized)
+	outputAnnotations = connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to change device authorization: %w", err)
+	}
+
+	ctxzap.Extract(ctx).Info("Device authorization has been changed.",
+		zap.String("deviceID", deviceID),
+		zap.Bool("authorized", authorized),
+	)
+
+	return outputAnnotations, nil
+}
+
+func deviceOwnerGrants(resource *v2.Resource, device *client.Device, users []client.User) []*v2.Grant {
+	if len(device.Tags) == 0 {
+		userIDs := GetUserIDsFromUserEmails(users, []string{device.User})
+		return userIDsToEntitlementGrants(resource, deviceOwnerEntitlement, userIDs)
+	}
+
+	var rv []*v2.Grant
+	for _, tag := range device.Tags {
+		principalID := &v2.ResourceId{ResourceType: tagResourceType.Id, Resource: tag}
+		rv = append(rv, grant.NewGrant(resource, deviceOwnerEntitlement, principalID))
+	}
+	return rv
+}
+
+// Delete removes the device from the tailnet.
+func (d *deviceBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	ratelimitData, err := d.client.DeleteDevice(ctx, resourceId.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to delete device: %w", err)
+	}
+
+	return outputAnnotations, nil
+}
+
+func (d *deviceBuilder) registerActions(manager *actionManager) {
+	manager.register(&v2.BatonActionSchema{
+		Name:        expireDeviceKeyAction,
+		DisplayName: "Expire Device Key",
+		Description: "Expires the node key of a device immediately, so that it has to re-authenticate.",
+		Arguments: []*configV1.Field{
+			stringActionField(deviceIDArgument, "Device ID", "The ID of the device.", true),
+		},
+		ReturnTypes: deviceKeyReturnTypes,
+	}, d.expireDeviceKey)
+
+	manager.register(&v2.BatonActionSchema{
+		Name:        setDeviceKeyExpiryAction,
+		DisplayName: "Set Device Key Expiry",
+		Description: "Turns key expiry of a device off or on.",
+		Arguments: []*configV1.Field{
+			stringActionField(deviceIDArgument, "Device ID", "The ID of the device.", true),
+			boolActionField(keyExpiryDisabledArgument, "Key Expiry Disabled", "Whether to turn key expiry off.", true),
+		},
+		ReturnTypes: deviceKeyReturnTypes,
+	}, d.setDeviceKeyExpiry)
+}
+
+func (d *deviceBuilder) expireDeviceKey(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	deviceID, err := stringActionArgument(args, deviceIDArgument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := d.client.ExpireDeviceKey(ctx, deviceID)
+	if err != nil {
+		return nil, connutils.WithRatelimitAnnotations(ratelimitData), err
+	}
+
+	return d.deviceKeyState(ctx, deviceID)
+}
+
+func (d *deviceBuilder) setDeviceKeyExpiry(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	deviceID, err := stringActionArgument(args, deviceIDArgument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyExpiryDisabled, err := boolActionArgument(args, keyExpiryDisabledArgument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := d.client.SetDeviceKeyExpiryDisabled(ctx, deviceID, keyExpiryDisabled)
+	if err != nil {
+		return nil, connutils.WithRatelimitAnnotations(ratelimitData), err
+	}
+
+	return d.deviceKeyState(ctx, deviceID)
+}
+
+// deviceKeyState reports the key expiry of a device as Tailscale has it
+// after an action.
+func (d *deviceBuilder) deviceKeyState(ctx context.Context, deviceID string) (*structpb.Struct, annotations.Annotations, error) {
+	device, ratelimitData, err := d.client.GetDevice(ctx, deviceID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	expires := ""
+	if !device.Expires.IsZero() {
+		expires = device.Expires.Format(time.RFC3339)
+	}
+
+	response, err := structpb.NewStruct(map[string]interface{}{
+		deviceIDArgument:          device.ID,
+		deviceKeyExpiresResponse:  expires,
+		keyExpiryDisabledArgument: device.KeyExpiryDisabled,
+	})
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	return response, outputAnnotations, nil
 }
 
-func newDeviceBuilder(client *client.Client, ignoreEphemeralDevices bool) *deviceBuilder {
+func newDeviceBuilder(client *client.Client, filter *deviceFilter) *deviceBuilder {
 	return &deviceBuilder{
-		resourceType:           deviceResourceType,
-		client:                 client,
-		ignoreEphemeralDevices: ignoreEphemeralDevices,
+		resourceType: deviceResourceType,
+		client:       client,
+		filter:       filter,
 	}
 }
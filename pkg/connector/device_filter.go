@@ -0,0 +1,139 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+)
+
+// DeviceFilter selects the devices that are synced. The zero value syncs
+// every device.
+type DeviceFilter struct {
+	// IgnoreEphemeral skips ephemeral devices, such as CI runners.
+	IgnoreEphemeral bool
+	// IgnoreExternal skips devices shared into the tailnet from other tailnets.
+	IgnoreExternal bool
+	// IncludeTags keeps only devices that carry at least one of the tags.
+	IncludeTags []string
+	// ExcludeTags skips devices that carry any of the tags.
+	ExcludeTags []string
+	// IncludeOS keeps only devices running one of the operating systems.
+	IncludeOS []string
+	// ExcludeOS skips devices running any of the operating systems.
+	ExcludeOS []string
+	// HostnamePattern keeps only devices whose hostname matches the regular expression.
+	HostnamePattern string
+	// ExcludeHostnamePattern skips devices whose hostname matches the regular expression.
+	ExcludeHostnamePattern string
+	// MaxLastSeenDays skips devices that have not been seen for more than
+	// this many days. Devices connected to the control plane are always kept.
+	MaxLastSeenDays int
+}
+
+// deviceFilter is the compiled form of a DeviceFilter. Every listing of
+// devices goes through it, so that devices that are filtered out never show
+// up in grants either.
+type deviceFilter struct {
+	DeviceFilter
+	hostnamePattern        *regexp.Regexp
+	excludeHostnamePattern *regexp.Regexp
+	now                    func() time.Time
+}
+
+func newDeviceFilter(filter DeviceFilter) (*deviceFilter, error) {
+	rv := &deviceFilter{
+		DeviceFilter: filter,
+		now:          time.Now,
+	}
+
+	if filter.HostnamePattern != "" {
+		hostnamePattern, err := regexp.Compile(filter.HostnamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("tailscale-connector: invalid device hostname pattern: %w", err)
+		}
+		rv.hostnamePattern = hostnamePattern
+	}
+
+	if filter.ExcludeHostnamePattern != "" {
+		excludeHostnamePattern, err := regexp.Compile(filter.ExcludeHostnamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("tailscale-connector: invalid device exclude hostname pattern: %w", err)
+		}
+		rv.excludeHostnamePattern = excludeHostnamePattern
+	}
+
+	if filter.MaxLastSeenDays < 0 {
+		return nil, fmt.Errorf("tailscale-connector: device max last seen days must not be negative")
+	}
+
+	return rv, nil
+}
+
+// includes reports whether the device passes every configured filter.
+func (f *deviceFilter) includes(device *client.Device) bool {
+	if f.IgnoreEphemeral && device.IsEphemeral {
+		return false
+	}
+	if f.IgnoreExternal && device.IsExternal {
+		return false
+	}
+	if len(f.IncludeTags) > 0 && !slices.ContainsFunc(device.Tags, func(tag string) bool {
+		return slices.Contains(f.IncludeTags, tag)
+	}) {
+		return false
+	}
+	if slices.ContainsFunc(device.Tags, func(tag string) bool {
+		return slices.Contains(f.ExcludeTags, tag)
+	}) {
+		return false
+	}
+	if len(f.IncludeOS) > 0 && !containsFold(f.IncludeOS, device.Os) {
+		return false
+	}
+	if containsFold(f.ExcludeOS, device.Os) {
+		return false
+	}
+	if f.hostnamePattern != nil && !f.hostnamePattern.MatchString(device.Hostname) {
+		return false
+	}
+	if f.excludeHostnamePattern != nil && f.excludeHostnamePattern.MatchString(device.Hostname) {
+		return false
+	}
+	if f.MaxLastSeenDays > 0 && !device.ConnectedToControl && !device.LastSeen.IsZero() {
+		maxAge := time.Duration(f.MaxLastSeenDays) * 24 * time.Hour
+		if f.now().Sub(device.LastSeen) > maxAge {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listDevices returns the devices of the tailnet that pass the filter.
+func (f *deviceFilter) listDevices(ctx context.Context, c *client.Client) ([]client.Device, *v2.RateLimitDescription, error) {
+	devices, ratelimitData, err := c.GetDevices(ctx)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	rv := make([]client.Device, 0, len(devices))
+	for _, device := range devices {
+		if f.includes(&device) {
+			rv = append(rv, device)
+		}
+	}
+
+	return rv, ratelimitData, nil
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
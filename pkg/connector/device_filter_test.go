@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceFilter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	filter, err := newDeviceFilter(DeviceFilter{
+		IgnoreEphemeral:        true,
+		IgnoreExternal:         true,
+		ExcludeTags:            []string{"tag:ci"},
+		IncludeOS:              []string{"linux", "macOS"},
+		HostnamePattern:        "^prod-",
+		ExcludeHostnamePattern: "-canary$",
+		MaxLastSeenDays:        30,
+	})
+	require.Nil(t, err)
+	filter.now = func() time.Time { return now }
+
+	device := client.Device{
+		Hostname: "prod-db-1",
+		Os:       "Linux",
+		Tags:     []string{"tag:prod"},
+		LastSeen: now.Add(-24 * time.Hour),
+	}
+	require.True(t, filter.includes(&device))
+
+	for name, mutate := range map[string]func(d *client.Device){
+		"ephemeral":         func(d *client.Device) { d.IsEphemeral = true },
+		"external":          func(d *client.Device) { d.IsExternal = true },
+		"excluded tag":      func(d *client.Device) { d.Tags = append(d.Tags, "tag:ci") },
+		"os":                func(d *client.Device) { d.Os = "windows" },
+		"hostname":          func(d *client.Device) { d.Hostname = "dev-db-1" },
+		"excluded hostname": func(d *client.Device) { d.Hostname = "prod-db-canary" },
+		"last seen age":     func(d *client.Device) { d.LastSeen = now.Add(-31 * 24 * time.Hour) },
+	} {
+		filtered := device
+		filtered.Tags = append([]string(nil), device.Tags...)
+		mutate(&filtered)
+		require.False(t, filter.includes(&filtered), name)
+	}
+
+	// Devices that are connected right now are never too old.
+	device.LastSeen = now.Add(-90 * 24 * time.Hour)
+	device.ConnectedToControl = true
+	require.True(t, filter.includes(&device))
+
+	filter, err = newDeviceFilter(DeviceFilter{IncludeTags: []string{"tag:prod"}})
+	require.Nil(t, err)
+	require.True(t, filter.includes(&client.Device{Tags: []string{"tag:server", "tag:prod"}}))
+	require.False(t, filter.includes(&client.Device{}))
+
+	_, err = newDeviceFilter(DeviceFilter{HostnamePattern: "("})
+	require.NotNil(t, err)
+	_, err = newDeviceFilter(DeviceFilter{ExcludeHostnamePattern: "("})
+	require.NotNil(t, err)
+}
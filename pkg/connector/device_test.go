@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceOwnerGrants(t *testing.T) {
+	resource := &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: deviceResourceType.Id, Resource: "12345"},
+	}
+	users := []client.User{
+		{ID: "u1", LoginName: "owner@example.com"},
+	}
+
+	grants := deviceOwnerGrants(resource, &client.Device{User: "owner@example.com"}, users)
+	require.Len(t, grants, 1)
+	require.Equal(t, userResourceType.Id, grants[0].Principal.Id.ResourceType)
+	require.Equal(t, "u1", grants[0].Principal.Id.Resource)
+
+	// Tagged devices are owned by their tags, not by whoever registered them.
+	grants = deviceOwnerGrants(resource, &client.Device{User: "owner@example.com", Tags: []string{"tag:prod", "tag:server"}}, users)
+	require.Len(t, grants, 2)
+	require.Equal(t, tagResourceType.Id, grants[0].Principal.Id.ResourceType)
+	require.Equal(t, "tag:prod", grants[0].Principal.Id.Resource)
+	require.Equal(t, "tag:server", grants[1].Principal.Id.Resource)
+}
+
+func TestDeviceFromProfile(t *testing.T) {
+	device := &client.Device{
+		ID:         "12345",
+		Name:       "server.example.ts.net",
+		User:       "owner@example.com",
+		Authorized: true,
+		Tags:       []string{"tag:prod", "tag:server"},
+	}
+	resource, err := deviceResource(context.Background(), device, nil)
+	require.Nil(t, err)
+
+	fromProfile, err := deviceFromProfile(resource)
+	require.Nil(t, err)
+	require.Equal(t, &client.Device{
+		ID:         "12345",
+		User:       "owner@example.com",
+		Authorized: true,
+		Tags:       []string{"tag:prod", "tag:server"},
+	}, fromProfile)
+
+	device.Authorized = false
+	device.Tags = nil
+	resource, err = deviceResource(context.Background(), device, nil)
+	require.Nil(t, err)
+	fromProfile, err = deviceFromProfile(resource)
+	require.Nil(t, err)
+	require.False(t, fromProfile.Authorized)
+	require.Empty(t, fromProfile.Tags)
+}
+
+func TestDeviceProfile(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	device := &client.Device{
+		ID:               "12345",
+		Name:             "laptop.example.ts.net",
+		Os:               "macOS",
+		Expires:          now.Add(10*24*time.Hour + time.Hour),
+		LastSeen:         now.Add(-3 * 24 * time.Hour),
+		Addresses:        []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+		AdvertisedRoutes: []string{"10.0.0.0/24"},
+	}
+
+	profile := deviceProfile(device, now)
+	require.Equal(t, "macOS", profile["os"])
+	require.Equal(t, "100.64.0.1,fd7a:115c:a1e0::1", profile["addresses"])
+	require.Equal(t, "10.0.0.0/24", profile["advertised_routes"])
+	require.Equal(t, int64(10), profile["key_expires_in_days"])
+	require.Equal(t, device.LastSeen.Format(time.RFC3339), profile["stale_since"])
+	require.Equal(t, int64(3), profile["stale_days"])
+
+	// Connected devices are not stale, and keys that never expire have no countdown.
+	device.ConnectedToControl = true
+	device.KeyExpiryDisabled = true
+	profile = deviceProfile(device, now)
+	require.NotContains(t, profile, "stale_since")
+	require.NotContains(t, profile, "key_expires_in_days")
+
+	// Expired keys count down below zero.
+	device.KeyExpiryDisabled = false
+	device.Expires = now.Add(-36 * time.Hour)
+	profile = deviceProfile(device, now)
+	require.Equal(t, int64(-2), profile["key_expires_in_days"])
+}
@@ -0,0 +1,234 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	resourceSDK "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grantRuleBuilder syncs the policy file's `grants` section. Every grant has a
+// member entitlement, plus one entitlement per app capability it grants.
+// All of them are held by the principals in the grant's `src`, so only the
+// member entitlement is provisioned: granting or revoking a capability alone
+// would change every other capability of the grant as well.
+type grantRuleBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client.Client
+}
+
+func grantRuleResource(grantRule client.Resource, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	return resourceSDK.NewResource(
+		grantRule.DisplayName,
+		grantRuleResourceType,
+		grantRule.Id,
+		resourceSDK.WithParentResourceID(parentResourceID),
+	)
+}
+
+func (o *grantRuleBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *grantRuleBuilder) List(
+	ctx context.Context,
+	parentID *v2.ResourceId,
+	_ *pagination.Token,
+) (
+	[]*v2.Resource,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	rules, ratelimitData, err := o.client.ListGrants(ctx)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	output := make([]*v2.Resource, 0)
+	for _, rule := range rules {
+		newResource, err := grantRuleResource(rule, parentID)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		output = append(output, newResource)
+	}
+	return output, "", outputAnnotations, nil
+}
+
+func (o *grantRuleBuilder) Entitlements(
+	ctx context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Entitlement,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	capabilities, ratelimitData, err := o.client.ListGrantCapabilities(ctx, resource.Id.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	output := []*v2.Entitlement{
+		entitlement.NewAssignmentEntitlement(
+			resource,
+			entitlementName,
+			entitlement.WithGrantableTo(userResourceType, inviteResourceType, groupResourceType, autogroupResourceType),
+			entitlement.WithDisplayName(
+				fmt.Sprintf("%s Grant Member", resource.DisplayName),
+			),
+			entitlement.WithDescription(
+				fmt.Sprintf("Is matched against the %s Grant in Tailscale", resource.DisplayName),
+			),
+		),
+	}
+
+	for _, capability := range capabilities {
+		output = append(
+			output,
+			entitlement.NewPermissionEntitlement(
+				resource,
+				capability,
+				entitlement.WithAnnotation(&v2.EntitlementImmutable{}),
+				entitlement.WithDisplayName(
+					fmt.Sprintf("%s Grant %s Capability", resource.DisplayName, capability),
+				),
+				entitlement.WithDescription(
+					fmt.Sprintf("Is granted the %s app capability by the %s Grant in Tailscale", capability, resource.DisplayName),
+				),
+			),
+		)
+	}
+
+	return output, "", outputAnnotations, nil
+}
+
+func (o *grantRuleBuilder) Grants(
+	ctx context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Grant,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	principals, err := getEmailPrincipals(ctx, o.client)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	sources, ratelimitData, err := o.client.ListGrantSources(ctx, resource.Id.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	capabilities, _, err := o.client.ListGrantCapabilities(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	grants := policyPrincipalGrants(resource, entitlementName, principals, sources)
+	for _, capability := range capabilities {
+		grants = append(grants, policyPrincipalGrants(resource, capability, principals, sources)...)
+	}
+
+	return grants, "", outputAnnotations, nil
+}
+
+// Grant adds the principal to the grant's `src`, which also grants every
+// capability of the grant.
+func (o *grantRuleBuilder) Grant(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+) (annotations.Annotations, error) {
+	err := checkGrantRuleEntitlement(entitlement.GetSlug())
+	if err != nil {
+		return nil, err
+	}
+
+	principalName, err := policyPrincipalName(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ratelimitData, err := o.client.AddEmailToGrant(ctx, entitlement.Resource.Id.Resource, principalName)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	if !result.Changed {
+		outputAnnotations.Append(&v2.GrantAlreadyExists{})
+	}
+
+	return outputAnnotations, nil
+}
+
+// Revoke removes the principal from the grant's `src`, which also revokes
+// every capability of the grant.
+func (o *grantRuleBuilder) Revoke(
+	ctx context.Context,
+	grant *v2.Grant,
+) (annotations.Annotations, error) {
+	err := checkGrantRuleEntitlement(grant.GetEntitlement().GetSlug())
+	if err != nil {
+		return nil, err
+	}
+
+	principalName, err := policyPrincipalName(grant.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+
+	result, ratelimitData, err := o.client.RemoveEmailFromGrant(
+		ctx,
+		grant.Entitlement.Resource.Id.Resource,
+		principalName,
+	)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	if !result.Changed {
+		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+	}
+
+	return outputAnnotations, nil
+}
+
+// checkGrantRuleEntitlement makes sure only the member entitlement of a grant
+// is provisioned. A capability cannot be granted or revoked on its own.
+func checkGrantRuleEntitlement(entitlementSlug string) error {
+	if entitlementSlug != entitlementName {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"tailscale-connector: the %s capability of a grant cannot be provisioned on its own, provision the %s entitlement instead",
+			entitlementSlug,
+			entitlementName,
+		)
+	}
+	return nil
+}
+
+func newGrantRuleBuilder(client *client.Client) *grantRuleBuilder {
+	return &grantRuleBuilder{
+		resourceType: grantRuleResourceType,
+		client:       client,
+	}
+}
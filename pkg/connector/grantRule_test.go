@@ -0,0 +1,26 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrantRuleRefusesCapabilityEntitlements(t *testing.T) {
+	ctx := context.Background()
+	builder := newGrantRuleBuilder(nil)
+
+	grantRule := &v2.Resource{Id: &v2.ResourceId{ResourceType: grantRuleResourceType.Id, Resource: "abc123"}}
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"}}
+	capabilityEntitlement := &v2.Entitlement{Resource: grantRule, Slug: "example.com/cap/admin"}
+
+	_, err := builder.Grant(ctx, user, capabilityEntitlement)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: capabilityEntitlement, Principal: user})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
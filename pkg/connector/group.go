@@ -77,6 +77,7 @@ func (o *groupBuilder) Entitlements(
 	membership := entitlement.NewAssignmentEntitlement(
 		resource,
 		entitlementName,
+		entitlement.WithGrantableTo(userResourceType, inviteResourceType),
 		entitlement.WithDisplayName(
 			fmt.Sprintf("%s Group Member", resource.DisplayName),
 		),
@@ -89,12 +90,25 @@ func (o *groupBuilder) Entitlements(
 }
 
 func userIDsToGrants(resource *v2.Resource, userIDs []string) []*v2.Grant {
+	return userIDsToEntitlementGrants(resource, entitlementName, userIDs)
+}
+
+func userIDsToEntitlementGrants(resource *v2.Resource, entitlementSlug string, userIDs []string) []*v2.Grant {
+	return principalIDsToEntitlementGrants(resource, entitlementSlug, userResourceType, userIDs)
+}
+
+func principalIDsToEntitlementGrants(
+	resource *v2.Resource,
+	entitlementSlug string,
+	principalType *v2.ResourceType,
+	principalIDs []string,
+) []*v2.Grant {
 	output := make([]*v2.Grant, 0)
-	for _, userID := range userIDs {
+	for _, principalID := range principalIDs {
 		userRes := &v2.Resource{
 			Id: &v2.ResourceId{
-				ResourceType: userResourceType.Id,
-				Resource:     userID,
+				ResourceType: principalType.Id,
+				Resource:     principalID,
 			},
 		}
 
@@ -102,7 +116,7 @@ func userIDsToGrants(resource *v2.Resource, userIDs []string) []*v2.Grant {
 			output,
 			grant.NewGrant(
 				resource,
-				entitlementName,
+				entitlementSlug,
 				userRes.Id,
 			),
 		)
@@ -120,11 +134,7 @@ func (o *groupBuilder) Grants(
 	annotations.Annotations,
 	error,
 ) {
-	var grants []*v2.Grant
-	var userIDs []string
-	var users []client.User
-
-	users, _, err := o.client.GetUsers(ctx)
+	principals, err := getEmailPrincipals(ctx, o.client)
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -135,19 +145,7 @@ func (o *groupBuilder) Grants(
 		return nil, "", outputAnnotations, err
 	}
 
-	userInvites, _, err := o.client.GetUserInvites(ctx)
-	if err != nil {
-		return nil, "", nil, err
-	}
-	for _, userInvite := range userInvites {
-		users = append(users, client.User{
-			ID:        userInvite.ID,
-			LoginName: userInvite.Email,
-		})
-	}
-
-	userIDs = GetUserIDsFromUserEmails(users, emails)
-	grants = append(grants, userIDsToGrants(resource, userIDs)...)
+	grants := principals.grants(resource, entitlementName, emails)
 
 	return grants, "", outputAnnotations, nil
 }
@@ -162,13 +160,13 @@ func (o *groupBuilder) Grant(
 		return nil, fmt.Errorf("tailscale-connector: Failed to get user trait from user: %w", err)
 	}
 
-	wasAdded, ratelimitData, err := o.client.AddEmailToGroup(ctx, entitlement.Resource.Id.Resource, userTrait.GetLogin())
-	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	result, ratelimitData, err := o.client.AddEmailToGroup(ctx, entitlement.Resource.Id.Resource, userTrait.GetLogin())
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
 	if err != nil {
 		return outputAnnotations, err
 	}
 
-	if !wasAdded {
+	if !result.Changed {
 		outputAnnotations.Append(&v2.GrantAlreadyExists{})
 	}
 
@@ -183,17 +181,17 @@ func (o *groupBuilder) Revoke(
 	if err != nil {
 		return nil, fmt.Errorf("tailscale-connector: Failed to get user trait from user: %w", err)
 	}
-	wasRevoked, ratelimitData, err := o.client.RemoveEmailFromGroup(
+	result, ratelimitData, err := o.client.RemoveEmailFromGroup(
 		ctx,
 		grant.Entitlement.Resource.Id.Resource,
 		userTrait.GetLogin(),
 	)
-	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
 	if err != nil {
 		return outputAnnotations, err
 	}
 
-	if !wasRevoked {
+	if !result.Changed {
 		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
 	}
 
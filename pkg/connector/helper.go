@@ -1,30 +1,23 @@
 package connector
 
 import (
-	"strconv"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
-	"github.com/conductorone/baton-sdk/pkg/pagination"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSDK "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-func unmarshalSkipToken(token *pagination.Token) (int32, *pagination.Bag, error) {
-	b := &pagination.Bag{}
-	err := b.Unmarshal(token.Token)
-	if err != nil {
-		return 0, nil, err
-	}
-	current := b.Current()
-	skip := int32(0)
-	if current != nil && current.Token != "" {
-		skip64, err := strconv.ParseInt(current.Token, 10, 32)
-		if err != nil {
-			return 0, nil, err
-		}
-		skip = int32(skip64)
-	}
-	return skip, b, nil
-}
-
 func GetUserIDsFromUserEmails(users []client.User, emails []string) []string {
 	IDperEmail := make(map[string]string)
 	for _, user := range users {
@@ -40,3 +33,160 @@ func GetUserIDsFromUserEmails(users []client.User, emails []string) []string {
 
 	return userIDs
 }
+
+// emailPrincipals resolves the emails in the policy file to users and to
+// pending user invites.
+type emailPrincipals struct {
+	users       []client.User
+	userInvites client.UserInvitesAPIData
+}
+
+func getEmailPrincipals(ctx context.Context, c *client.Client) (*emailPrincipals, error) {
+	users, _, err := c.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userInvites, _, err := c.GetUserInvites(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &emailPrincipals{
+		users:       users,
+		userInvites: userInvites,
+	}, nil
+}
+
+// grants grants an entitlement to the users and invites with one of the emails.
+func (p *emailPrincipals) grants(resource *v2.Resource, entitlementSlug string, emails []string) []*v2.Grant {
+	userIDs := GetUserIDsFromUserEmails(p.users, emails)
+	grants := userIDsToEntitlementGrants(resource, entitlementSlug, userIDs)
+
+	var inviteIDs []string
+	for _, userInvite := range p.userInvites {
+		if slices.Contains(emails, userInvite.Email) {
+			inviteIDs = append(inviteIDs, userInvite.ID)
+		}
+	}
+
+	return append(grants, principalIDsToEntitlementGrants(resource, entitlementSlug, inviteResourceType, inviteIDs)...)
+}
+
+// groupGrant grants an entitlement to a policy file group. The grant expands
+// to every member of the group.
+func groupGrant(resource *v2.Resource, entitlementSlug string, groupName string) *v2.Grant {
+	return expandableGrant(resource, entitlementSlug, groupResourceType, groupName)
+}
+
+// expandableGrant grants an entitlement to a group-like principal, e.g. a
+// group, an autogroup or a role. The grant expands to the principal's members.
+func expandableGrant(
+	resource *v2.Resource,
+	entitlementSlug string,
+	principalType *v2.ResourceType,
+	principalID string,
+) *v2.Grant {
+	principal := &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: principalType.Id,
+			Resource:     principalID,
+		},
+	}
+
+	return grant.NewGrant(
+		resource,
+		entitlementSlug,
+		principal.Id,
+		grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{entitlement.NewEntitlementID(principal, entitlementName)},
+		}),
+	)
+}
+
+// policyPrincipalGrants grants an entitlement to the principals referenced in
+// the policy file. Groups and autogroups expand to their members, and emails
+// are matched against users and invites.
+func policyPrincipalGrants(
+	resource *v2.Resource,
+	entitlementSlug string,
+	emailPrincipals *emailPrincipals,
+	principals []string,
+) []*v2.Grant {
+	var grants []*v2.Grant
+	for _, principal := range principals {
+		if strings.HasPrefix(principal, client.GroupPrefix) {
+			grants = append(grants, groupGrant(resource, entitlementSlug, principal))
+		}
+		if group, ok := findAutogroup(principal); ok {
+			grants = append(grants, expandableGrant(resource, entitlementSlug, autogroupResourceType, group.id()))
+		}
+	}
+
+	return append(grants, emailPrincipals.grants(resource, entitlementSlug, principals)...)
+}
+
+// policyPrincipalName returns how a principal is referenced in the policy
+// file: users by their login email, groups by their `group:` or
+// `autogroup:` name.
+func policyPrincipalName(principal *v2.Resource) (string, error) {
+	switch principal.Id.ResourceType {
+	case groupResourceType.Id, autogroupResourceType.Id:
+		return principal.Id.Resource, nil
+	}
+
+	userTrait, err := resourceSDK.GetUserTrait(principal)
+	if err != nil {
+		return "", fmt.Errorf("tailscale-connector: Failed to get user trait from user: %w", err)
+	}
+	return userTrait.GetLogin(), nil
+}
+
+// policyWriteAnnotations returns the annotations of a policy file edit: the
+// rate limit data and a struct with the output of validating the edited
+// policy file under `policy_validation`, also when the edit was rejected,
+// and in dry-run mode the diff the edit would have made under `policy_diff`.
+func policyWriteAnnotations(
+	ratelimitData *v2.RateLimitDescription,
+	result *client.PolicyWriteResult,
+	err error,
+) annotations.Annotations {
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+
+	details := make(map[string]interface{})
+	var validationErr *client.PolicyValidationError
+	if errors.As(err, &validationErr) {
+		details["policy_validation"] = validationErr.Validation
+	} else if result != nil {
+		if result.Validation != nil {
+			details["policy_validation"] = result.Validation
+		}
+		if result.Diff != "" {
+			details["policy_diff"] = result.Diff
+		}
+	}
+
+	if len(details) > 0 {
+		detailsStruct, err := jsonStruct(details)
+		if err == nil {
+			outputAnnotations.Append(detailsStruct)
+		}
+	}
+
+	return outputAnnotations
+}
+
+// jsonStruct converts details to a struct annotation through their JSON form.
+func jsonStruct(details map[string]interface{}) (*structpb.Struct, error) {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+
+	detailsStruct := &structpb.Struct{}
+	err = detailsStruct.UnmarshalJSON(detailsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return detailsStruct, nil
+}
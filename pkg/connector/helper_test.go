@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestEmailPrincipalsGrants(t *testing.T) {
+	resource := &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: groupResourceType.Id, Resource: "group:devs"},
+	}
+	principals := &emailPrincipals{
+		users: []client.User{
+			{ID: "u1", LoginName: "member@example.com"},
+			{ID: "u2", LoginName: "other@example.com"},
+		},
+		userInvites: client.UserInvitesAPIData{
+			{ID: "i1", Email: "invited@example.com"},
+		},
+	}
+
+	grants := principals.grants(resource, entitlementName, []string{"member@example.com", "invited@example.com"})
+	require.Len(t, grants, 2)
+	require.Equal(t, userResourceType.Id, grants[0].Principal.Id.ResourceType)
+	require.Equal(t, "u1", grants[0].Principal.Id.Resource)
+	require.Equal(t, inviteResourceType.Id, grants[1].Principal.Id.ResourceType)
+	require.Equal(t, "i1", grants[1].Principal.Id.Resource)
+}
+
+func TestPolicyWriteAnnotations(t *testing.T) {
+	validation := &client.PolicyValidation{
+		Message: "test(s) failed",
+		Data: []client.PolicyValidationEntry{
+			{User: "member@example.com", Errors: []string{"member@example.com cannot access tag:prod:22"}},
+		},
+	}
+
+	outputAnnotations := policyWriteAnnotations(nil, nil, &client.PolicyValidationError{Validation: validation})
+	detailsStruct := &structpb.Struct{}
+	ok, err := outputAnnotations.Pick(detailsStruct)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	policyValidation := detailsStruct.GetFields()["policy_validation"].GetStructValue()
+	require.Equal(t, "test(s) failed", policyValidation.GetFields()["message"].GetStringValue())
+	entries := policyValidation.GetFields()["data"].GetListValue().GetValues()
+	require.Len(t, entries, 1)
+	require.Equal(t, "member@example.com", entries[0].GetStructValue().GetFields()["user"].GetStringValue())
+
+	outputAnnotations = policyWriteAnnotations(nil, &client.PolicyWriteResult{Changed: true}, nil)
+	ok, err = outputAnnotations.Pick(&structpb.Struct{})
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	diff := "--- policy.hujson (current)\n+++ policy.hujson (proposed)\n"
+	outputAnnotations = policyWriteAnnotations(nil, &client.PolicyWriteResult{Changed: true, Diff: diff}, nil)
+	detailsStruct = &structpb.Struct{}
+	ok, err = outputAnnotations.Pick(detailsStruct)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, diff, detailsStruct.GetFields()["policy_diff"].GetStringValue())
+}
@@ -23,7 +23,7 @@ func TestConnector(t *testing.T) {
 		t.Skip()
 	}
 
-	cliTest, err := client.New(ctx, apiKey, tailnet)
+	cliTest, err := client.New(ctx, client.Credentials{APIKey: apiKey}, client.Credentials{}, tailnet, true, false, "")
 	require.Nil(t, err)
 
 	u := &userBuilder{
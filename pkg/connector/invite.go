@@ -0,0 +1,162 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	configV1 "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	resendInviteAction = "resend_invite"
+	inviteIDArgument   = "invite_id"
+)
+
+// inviteBuilder syncs pending user invites. Invites become users once they
+// are accepted.
+type inviteBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client.Client
+}
+
+func (i *inviteBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return i.resourceType
+}
+
+func inviteResource(_ context.Context, userInvite *client.UserInvite, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"login":      userInvite.Email,
+		"email":      userInvite.Email,
+		"invite_id":  userInvite.ID,
+		"role":       userInvite.Role,
+		"inviter_id": strconv.FormatInt(userInvite.InviterID, 10),
+		"invite_url": userInvite.InviteURL,
+	}
+	if !userInvite.LastEmailSentAt.IsZero() {
+		profile["last_email_sent_at"] = userInvite.LastEmailSentAt.Format(time.RFC3339)
+	}
+
+	// The account does not exist until the invite is accepted, so it has no status yet.
+	userTraits := []rs.UserTraitOption{
+		rs.WithUserProfile(profile),
+		rs.WithStatus(v2.UserTrait_Status_STATUS_UNSPECIFIED),
+		rs.WithUserLogin(userInvite.Email),
+		rs.WithEmail(userInvite.Email, true),
+	}
+
+	return rs.NewUserResource(
+		userInvite.Email,
+		inviteResourceType,
+		userInvite.ID,
+		userTraits,
+		rs.WithParentResourceID(parentResourceID),
+	)
+}
+
+func (i *inviteBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var rv []*v2.Resource
+	userInvites, ratelimitData, err := i.client.GetUserInvites(ctx)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	for _, userInvite := range userInvites {
+		inviteCopy := userInvite
+		ir, err := inviteResource(ctx, &inviteCopy, parentResourceID)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+
+		rv = append(rv, ir)
+	}
+
+	return rv, "", outputAnnotations, nil
+}
+
+// Entitlements always returns an empty slice for invites.
+func (i *inviteBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants always returns an empty slice for invites since they don't have any entitlements.
+func (i *inviteBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Delete cancels the invite.
+func (i *inviteBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	ratelimitData, err := i.client.DeleteUserInvite(ctx, resourceId.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to cancel invite: %w", err)
+	}
+
+	return outputAnnotations, nil
+}
+
+func (i *inviteBuilder) registerActions(manager *actionManager) {
+	manager.register(&v2.BatonActionSchema{
+		Name:        resendInviteAction,
+		DisplayName: "Resend Invite",
+		Description: "Sends the email of a pending user invite again.",
+		Arguments: []*configV1.Field{
+			stringActionField(inviteIDArgument, "Invite ID", "The ID of the invite to resend.", true),
+		},
+		ReturnTypes: []*configV1.Field{
+			stringActionField(inviteIDArgument, "Invite ID", "The ID of the invite.", true),
+			stringActionField("email", "Email", "The email address the invite was sent to.", true),
+			stringActionField("last_email_sent_at", "Last Email Sent At", "When the invite email was last sent.", false),
+		},
+	}, i.resendInvite)
+}
+
+func (i *inviteBuilder) resendInvite(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	inviteID, err := stringActionArgument(args, inviteIDArgument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratelimitData, err := i.client.ResendUserInvite(ctx, inviteID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	userInvite, ratelimitData, err := i.client.GetUserInvite(ctx, inviteID)
+	outputAnnotations = connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	fields := map[string]interface{}{
+		inviteIDArgument: userInvite.ID,
+		"email":          userInvite.Email,
+	}
+	if !userInvite.LastEmailSentAt.IsZero() {
+		fields["last_email_sent_at"] = userInvite.LastEmailSentAt.Format(time.RFC3339)
+	}
+
+	response, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	return response, outputAnnotations, nil
+}
+
+func newInviteBuilder(client *client.Client) *inviteBuilder {
+	return &inviteBuilder{
+		resourceType: inviteResourceType,
+		client:       client,
+	}
+}
@@ -12,6 +12,12 @@ var (
 		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
 	}
 
+	autogroupResourceType = &v2.ResourceType{
+		Id:          "autogroup",
+		DisplayName: "Autogroup",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+	}
+
 	sshRuleResourceType = &v2.ResourceType{
 		Id:          "sshrule",
 		DisplayName: "SSH Rule",
@@ -21,6 +27,11 @@ var (
 		Id:          "aclrule",
 		DisplayName: "ACL Rule",
 	}
+
+	grantRuleResourceType = &v2.ResourceType{
+		Id:          "grant",
+		DisplayName: "Grant",
+	}
 	userResourceType = &v2.ResourceType{
 		Id:          "user",
 		DisplayName: "User",
@@ -33,9 +44,15 @@ var (
 	deviceResourceType = &v2.ResourceType{
 		Id:          "device",
 		DisplayName: "Device",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	tagResourceType = &v2.ResourceType{
+		Id:          "tag",
+		DisplayName: "Tag",
 	}
 	inviteResourceType = &v2.ResourceType{
 		Id:          "invite",
 		DisplayName: "Invite",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
 	}
 )
@@ -2,7 +2,9 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -11,6 +13,7 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
 )
@@ -20,10 +23,32 @@ type roleBuilder struct {
 	client       *client.Client
 }
 
+const (
+	// defaultRole is the role users hold when no other role was assigned.
+	defaultRole = "member"
+	// ownerRole is held by the user who created the tailnet. Ownership can only
+	// be transferred in the admin console.
+	ownerRole = "owner"
+)
+
+// assignableRoles are the roles the API accepts when changing the role of a
+// user or inviting one.
 // Standard roles: Owner, Admin, Member
 // Advanced roles: Billing admin, IT admin, Network admin, Auditor
 // https://tailscale.com/kb/1138/user-roles
-var roles = []string{"owner", "admin", "member", "billing-admin", "it-admin", "network-admin", "auditor"}
+var assignableRoles = []string{"admin", "member", "billing-admin", "it-admin", "network-admin", "auditor"}
+
+// validateAssignableRole returns an error for roles that cannot be assigned
+// through the API.
+func validateAssignableRole(roleName string) error {
+	if roleName == ownerRole {
+		return errors.New("tailscale-connector: the owner role cannot be granted, ownership can only be transferred in the admin console")
+	}
+	if !slices.Contains(assignableRoles, roleName) {
+		return fmt.Errorf("tailscale-connector: invalid role: %s", roleName)
+	}
+	return nil
+}
 
 func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return r.resourceType
@@ -54,9 +79,33 @@ func roleResource(ctx context.Context, role *client.Role, parentResourceID *v2.R
 	return ret, nil
 }
 
+// List returns the owner and assignable roles, and any other role held by a
+// user or invite, so that roles Tailscale adds later are synced too.
 func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	users, _, err := r.client.GetUsers(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	userInvites, _, err := r.client.GetUserInvites(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	roleNames := append([]string{ownerRole}, assignableRoles...)
+	for _, user := range users {
+		roleNames = append(roleNames, user.Role)
+	}
+	for _, userInvite := range userInvites {
+		roleNames = append(roleNames, userInvite.Role)
+	}
+
 	var rv []*v2.Resource
-	for _, role := range roles {
+	for _, role := range connutils.Unique(roleNames) {
+		if role == "" {
+			continue
+		}
+
 		ur, err := roleResource(ctx, &client.Role{
 			ID:   role,
 			Name: role,
@@ -76,7 +125,7 @@ func (r *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *
 		ent.NewAssignmentEntitlement(
 			resource,
 			"member",
-			ent.WithGrantableTo(userResourceType),
+			ent.WithGrantableTo(userResourceType, inviteResourceType),
 			ent.WithDisplayName(fmt.Sprintf("%s Role Member", resource.DisplayName)),
 			ent.WithDescription(fmt.Sprintf("Member of %s Role", resource.DisplayName)),
 		),
@@ -101,25 +150,80 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		rv = append(rv, gr)
 	}
 
+	// Invites are granted the role the user will hold once they accept.
+	userInvites, _, err := r.client.GetUserInvites(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, userInvite := range userInvites {
+		if roleName != userInvite.Role {
+			continue
+		}
+
+		principalID := &v2.ResourceId{ResourceType: inviteResourceType.Id, Resource: userInvite.ID}
+		gr := grant.NewGrant(resource, "member", principalID)
+		rv = append(rv, gr)
+	}
+
 	return rv, "", nil, nil
 }
 
-func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+// Grant changes the role of a user or invite. A user holds a single role, so
+// the grant replaces their previous role.
+func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) ([]*v2.Grant, annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
-	if principal.Id.ResourceType != userResourceType.Id {
+	roleName := entitlement.Resource.Id.Resource
+	err := validateAssignableRole(roleName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch principal.Id.ResourceType {
+	case inviteResourceType.Id:
+		return r.grantInviteRole(ctx, principal.Id.Resource, entitlement.Resource)
+	case userResourceType.Id:
+	default:
 		l.Warn(
-			"baton-tailscale: only users can be granted role membership",
+			"baton-tailscale: only users and invites can be granted role membership",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-tailscale: only users can be granted role membership")
+		return nil, nil, fmt.Errorf("baton-tailscale: only users and invites can be granted role membership")
 	}
 
 	userID := principal.Id.Resource
-	roleName := entitlement.Resource.Id.Resource
-	err := r.client.UpdateUserRole(ctx, userID, roleName)
+	user, ratelimitData, err := r.client.GetUser(ctx, userID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, fmt.Errorf("tailscale-connector: failed to get user: %w", err)
+	}
+
+	if user.Role == roleName {
+		outputAnnotations.Append(&v2.GrantAlreadyExists{})
+		return []*v2.Grant{grant.NewGrant(entitlement.Resource, "member", principal.Id)}, outputAnnotations, nil
+	}
+
+	if user.Role == ownerRole {
+		err = r.checkOtherOwnerExists(ctx, userID)
+		if err != nil {
+			return nil, outputAnnotations, err
+		}
+	}
+
+	updatedUser, ratelimitData, err := r.client.UpdateUserRole(ctx, userID, roleName)
+	outputAnnotations = connutils.WithRatelimitAnnotations(ratelimitData)
 	if err != nil {
-		return nil, fmt.Errorf("tailscale-connector: failed to add user role: %s", err.Error())
+		return nil, outputAnnotations, fmt.Errorf("tailscale-connector: failed to add user role: %w", err)
+	}
+
+	if updatedUser.Role != roleName {
+		return nil, outputAnnotations, fmt.Errorf(
+			"tailscale-connector: user %s holds the %s role after the update, expected %s",
+			userID,
+			updatedUser.Role,
+			roleName,
+		)
 	}
 
 	l.Info("Role Membership has been created.",
@@ -127,29 +231,59 @@ func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 		zap.String("roleName", roleName),
 	)
 
-	return nil, nil
+	principalID := &v2.ResourceId{ResourceType: userResourceType.Id, Resource: updatedUser.ID}
+	return []*v2.Grant{grant.NewGrant(entitlement.Resource, "member", principalID)}, outputAnnotations, nil
 }
 
+// Revoke sets a user or invite back to the default role, unless they no
+// longer hold the revoked role.
 func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 	principal := grant.Principal
 	entitlement := grant.Entitlement
-	if principal.Id.ResourceType != userResourceType.Id {
+	roleName := entitlement.Resource.Id.Resource
+	if roleName == defaultRole {
+		return nil, fmt.Errorf("tailscale-connector: %s is the default role and cannot be revoked", defaultRole)
+	}
+
+	switch principal.Id.ResourceType {
+	case inviteResourceType.Id:
+		return r.revokeInviteRole(ctx, principal.Id.Resource, roleName)
+	case userResourceType.Id:
+	default:
 		l.Warn(
-			"tailscale-connector: only users can have user membership revoked",
+			"tailscale-connector: only users and invites can have role membership revoked",
 			zap.String("principal_id", principal.Id.String()),
 			zap.String("principal_type", principal.Id.ResourceType),
 		)
 
-		return nil, fmt.Errorf("tailscale-connector: only users can have user membership revoked")
+		return nil, fmt.Errorf("tailscale-connector: only users and invites can have role membership revoked")
 	}
 
 	userID := principal.Id.Resource
-	roleName := entitlement.Resource.Id.Resource
+	user, ratelimitData, err := r.client.GetUser(ctx, userID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to get user: %w", err)
+	}
+
+	if user.Role != roleName {
+		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+		return outputAnnotations, nil
+	}
+
+	if roleName == ownerRole {
+		err = r.checkOtherOwnerExists(ctx, userID)
+		if err != nil {
+			return outputAnnotations, err
+		}
+	}
+
 	// users on a tailnet are members by default.
-	err := r.client.UpdateUserRole(ctx, userID, "member")
+	_, ratelimitData, err = r.client.UpdateUserRole(ctx, userID, defaultRole)
+	outputAnnotations = connutils.WithRatelimitAnnotations(ratelimitData)
 	if err != nil {
-		return nil, fmt.Errorf("tailscale-connector: failed to revoke user role: %s", err.Error())
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to revoke user role: %w", err)
 	}
 
 	l.Info("Role Membership has been revoked.",
@@ -157,7 +291,84 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 		zap.String("roleName", roleName),
 	)
 
-	return nil, nil
+	return outputAnnotations, nil
+}
+
+// checkOtherOwnerExists refuses to change the role of the last owner, which
+// would leave the tailnet without one.
+func (r *roleBuilder) checkOtherOwnerExists(ctx context.Context, userID string) error {
+	owners, _, err := r.client.GetUsersWithRole(ctx, ownerRole)
+	if err != nil {
+		return fmt.Errorf("tailscale-connector: failed to list owners: %w", err)
+	}
+
+	for _, owner := range owners {
+		if owner.ID != userID {
+			return nil
+		}
+	}
+	return fmt.Errorf("tailscale-connector: user %s is the last owner of the tailnet, refusing to change their role", userID)
+}
+
+// grantInviteRole re-issues a pending invite with the role, unless the
+// invite already has it.
+func (r *roleBuilder) grantInviteRole(ctx context.Context, inviteID string, role *v2.Resource) ([]*v2.Grant, annotations.Annotations, error) {
+	userInvite, ratelimitData, err := r.client.GetUserInvite(ctx, inviteID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, fmt.Errorf("tailscale-connector: failed to get invite: %w", err)
+	}
+
+	if userInvite.Role != role.Id.Resource {
+		userInvite, outputAnnotations, err = r.reissueInvite(ctx, userInvite, role.Id.Resource)
+		if err != nil {
+			return nil, outputAnnotations, err
+		}
+	} else {
+		outputAnnotations.Append(&v2.GrantAlreadyExists{})
+	}
+
+	principalID := &v2.ResourceId{ResourceType: inviteResourceType.Id, Resource: userInvite.ID}
+	return []*v2.Grant{grant.NewGrant(role, "member", principalID)}, outputAnnotations, nil
+}
+
+// revokeInviteRole re-issues a pending invite with the default role, unless
+// the invite no longer has the revoked role.
+func (r *roleBuilder) revokeInviteRole(ctx context.Context, inviteID string, roleName string) (annotations.Annotations, error) {
+	userInvite, ratelimitData, err := r.client.GetUserInvite(ctx, inviteID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to get invite: %w", err)
+	}
+
+	if userInvite.Role != roleName {
+		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+		return outputAnnotations, nil
+	}
+
+	_, outputAnnotations, err = r.reissueInvite(ctx, userInvite, defaultRole)
+	return outputAnnotations, err
+}
+
+func (r *roleBuilder) reissueInvite(
+	ctx context.Context,
+	userInvite *client.UserInvite,
+	roleName string,
+) (*client.UserInvite, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	newInvite, ratelimitData, err := r.client.ReissueUserInvite(ctx, userInvite, roleName)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, fmt.Errorf("tailscale-connector: failed to change invite role: %w", err)
+	}
+
+	l.Info("Invite has been re-issued with a new role.",
+		zap.String("oldInviteID", userInvite.ID),
+		zap.String("newInviteID", newInvite.ID),
+		zap.String("roleName", roleName),
+	)
+
+	return newInvite, outputAnnotations, nil
 }
 
 func newRoleBuilder(client *client.Client) *roleBuilder {
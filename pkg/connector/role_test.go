@@ -0,0 +1,15 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAssignableRole(t *testing.T) {
+	require.Nil(t, validateAssignableRole("admin"))
+	require.Nil(t, validateAssignableRole("network-admin"))
+	require.NotNil(t, validateAssignableRole("owner"))
+	require.NotNil(t, validateAssignableRole("superuser"))
+	require.NotNil(t, validateAssignableRole(""))
+}
@@ -71,6 +71,7 @@ func (o *sshRuleBuilder) Entitlements(
 	membership := entitlement.NewAssignmentEntitlement(
 		resource,
 		entitlementName,
+		entitlement.WithGrantableTo(userResourceType, inviteResourceType, groupResourceType, autogroupResourceType),
 		entitlement.WithDisplayName(
 			fmt.Sprintf("%s SSH Rule Member", resource.DisplayName),
 		),
@@ -92,31 +93,18 @@ func (o *sshRuleBuilder) Grants(
 	annotations.Annotations,
 	error,
 ) {
-	emails, ratelimitData, err := o.client.ListSSHEmails(ctx, resource.Id.Resource)
+	sources, ratelimitData, err := o.client.ListSSHSources(ctx, resource.Id.Resource)
 	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
 	if err != nil {
 		return nil, "", outputAnnotations, err
 	}
 
-	users, _, err := o.client.GetUsers(ctx)
+	principals, err := getEmailPrincipals(ctx, o.client)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	userInvites, _, err := o.client.GetUserInvites(ctx)
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	for _, userInvite := range userInvites {
-		users = append(users, client.User{
-			ID:        userInvite.ID,
-			LoginName: userInvite.Email,
-		})
-	}
-
-	userIDs := GetUserIDsFromUserEmails(users, emails)
-	grants := userIDsToGrants(resource, userIDs)
+	grants := policyPrincipalGrants(resource, entitlementName, principals, sources)
 
 	return grants, "", outputAnnotations, nil
 }
@@ -126,18 +114,18 @@ func (o *sshRuleBuilder) Grant(
 	principal *v2.Resource,
 	entitlement *v2.Entitlement,
 ) (annotations.Annotations, error) {
-	userTrait, err := resourceSDK.GetUserTrait(principal)
+	principalName, err := policyPrincipalName(principal)
 	if err != nil {
-		return nil, fmt.Errorf("tailscale-connector: Failed to get user trait from user: %w", err)
+		return nil, err
 	}
 
-	wasAdded, ratelimitData, err := o.client.AddEmailToSSHRule(ctx, entitlement.Resource.Id.Resource, userTrait.GetLogin())
-	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	result, ratelimitData, err := o.client.AddEmailToSSHRule(ctx, entitlement.Resource.Id.Resource, principalName)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
 	if err != nil {
 		return outputAnnotations, err
 	}
 
-	if !wasAdded {
+	if !result.Changed {
 		outputAnnotations.Append(&v2.GrantAlreadyExists{})
 	}
 
@@ -148,22 +136,22 @@ func (o *sshRuleBuilder) Revoke(
 	ctx context.Context,
 	grant *v2.Grant,
 ) (annotations.Annotations, error) {
-	userTrait, err := resourceSDK.GetUserTrait(grant.GetPrincipal())
+	principalName, err := policyPrincipalName(grant.GetPrincipal())
 	if err != nil {
-		return nil, fmt.Errorf("tailscale-connector: Failed to get user trait from user: %w", err)
+		return nil, err
 	}
 
-	wasRevoked, ratelimitData, err := o.client.RemoveEmailFromSSHRule(
+	result, ratelimitData, err := o.client.RemoveEmailFromSSHRule(
 		ctx,
 		grant.Entitlement.Resource.Id.Resource,
-		userTrait.GetLogin(),
+		principalName,
 	)
-	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
 	if err != nil {
 		return outputAnnotations, err
 	}
 
-	if !wasRevoked {
+	if !result.Changed {
 		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
 	}
 
@@ -0,0 +1,285 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSDK "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	tagOwnerEntitlement  = "owner"
+	tagDeviceEntitlement = "device"
+)
+
+// tagBuilder syncs the tags declared in the policy file's `tagOwners`.
+// Owners of a tag can apply it to devices, and devices carrying the tag
+// are granted its device entitlement.
+type tagBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client.Client
+	devices      *deviceFilter
+}
+
+func tagResource(tag client.Resource, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	return resourceSDK.NewResource(
+		tag.DisplayName,
+		tagResourceType,
+		tag.Id,
+		resourceSDK.WithParentResourceID(parentResourceID),
+	)
+}
+
+func (o *tagBuilder) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *tagBuilder) List(
+	ctx context.Context,
+	parentID *v2.ResourceId,
+	_ *pagination.Token,
+) (
+	[]*v2.Resource,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	tags, ratelimitData, err := o.client.ListTags(ctx)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	output := make([]*v2.Resource, 0)
+	for _, tag := range tags {
+		newResource, err := tagResource(tag, parentID)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		output = append(output, newResource)
+	}
+	return output, "", outputAnnotations, nil
+}
+
+func (o *tagBuilder) Entitlements(
+	_ context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Entitlement,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	ownership := entitlement.NewAssignmentEntitlement(
+		resource,
+		tagOwnerEntitlement,
+		entitlement.WithGrantableTo(userResourceType, inviteResourceType, groupResourceType, autogroupResourceType),
+		entitlement.WithDisplayName(
+			fmt.Sprintf("%s Tag Owner", resource.DisplayName),
+		),
+		entitlement.WithDescription(
+			fmt.Sprintf("Can apply the %s tag to devices in Tailscale", resource.DisplayName),
+		),
+	)
+
+	device := entitlement.NewAssignmentEntitlement(
+		resource,
+		tagDeviceEntitlement,
+		entitlement.WithGrantableTo(deviceResourceType),
+		entitlement.WithDisplayName(
+			fmt.Sprintf("%s Tagged Device", resource.DisplayName),
+		),
+		entitlement.WithDescription(
+			fmt.Sprintf("Device carries the %s tag in Tailscale", resource.DisplayName),
+		),
+	)
+
+	return []*v2.Entitlement{ownership, device}, "", nil, nil
+}
+
+func (o *tagBuilder) Grants(
+	ctx context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Grant,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	principals, err := getEmailPrincipals(ctx, o.client)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	owners, ratelimitData, err := o.client.ListTagOwners(ctx, resource.Id.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	grants := policyPrincipalGrants(resource, tagOwnerEntitlement, principals, owners)
+
+	devices, ratelimitData, err := o.devices.listDevices(ctx, o.client)
+	outputAnnotations = connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	for _, device := range devices {
+		if !slices.Contains(device.Tags, resource.Id.Resource) {
+			continue
+		}
+
+		deviceID := &v2.ResourceId{
+			ResourceType: deviceResourceType.Id,
+			Resource:     device.ID,
+		}
+		grants = append(grants, grant.NewGrant(resource, tagDeviceEntitlement, deviceID))
+	}
+
+	return grants, "", outputAnnotations, nil
+}
+
+func (o *tagBuilder) Grant(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+) (annotations.Annotations, error) {
+	err := checkTagPrincipal(entitlement.GetSlug(), principal.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if entitlement.GetSlug() == tagDeviceEntitlement {
+		wasAdded, ratelimitData, err := o.client.AddTagToDevice(
+			ctx,
+			principal.Id.Resource,
+			entitlement.Resource.Id.Resource,
+		)
+		outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+		if err != nil {
+			return outputAnnotations, err
+		}
+
+		if !wasAdded {
+			outputAnnotations.Append(&v2.GrantAlreadyExists{})
+		}
+
+		return outputAnnotations, nil
+	}
+
+	owner, err := policyPrincipalName(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ratelimitData, err := o.client.AddOwnerToTag(ctx, entitlement.Resource.Id.Resource, owner)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	if !result.Changed {
+		outputAnnotations.Append(&v2.GrantAlreadyExists{})
+	}
+
+	return outputAnnotations, nil
+}
+
+func (o *tagBuilder) Revoke(
+	ctx context.Context,
+	grant *v2.Grant,
+) (annotations.Annotations, error) {
+	principal := grant.GetPrincipal()
+	err := checkTagPrincipal(grant.GetEntitlement().GetSlug(), principal.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if grant.GetEntitlement().GetSlug() == tagDeviceEntitlement {
+		wasRevoked, ratelimitData, err := o.client.RemoveTagFromDevice(
+			ctx,
+			principal.Id.Resource,
+			grant.Entitlement.Resource.Id.Resource,
+		)
+		outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+		if err != nil {
+			return outputAnnotations, err
+		}
+
+		if !wasRevoked {
+			outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+		}
+
+		return outputAnnotations, nil
+	}
+
+	owner, err := policyPrincipalName(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ratelimitData, err := o.client.RemoveOwnerFromTag(
+		ctx,
+		grant.Entitlement.Resource.Id.Resource,
+		owner,
+	)
+	outputAnnotations := policyWriteAnnotations(ratelimitData, result, err)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	if !result.Changed {
+		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+	}
+
+	return outputAnnotations, nil
+}
+
+// checkTagPrincipal makes sure the principal can hold the tag entitlement:
+// only devices carry a tag, and devices cannot own one.
+func checkTagPrincipal(entitlementSlug string, principalID *v2.ResourceId) error {
+	isDevice := principalID.GetResourceType() == deviceResourceType.Id
+	switch entitlementSlug {
+	case tagDeviceEntitlement:
+		if !isDevice {
+			return status.Errorf(
+				codes.InvalidArgument,
+				"tailscale-connector: only devices can be granted the %s entitlement of a tag, got %s",
+				entitlementSlug,
+				principalID.GetResourceType(),
+			)
+		}
+	case tagOwnerEntitlement:
+		if isDevice {
+			return status.Errorf(
+				codes.InvalidArgument,
+				"tailscale-connector: devices cannot be granted the %s entitlement of a tag",
+				entitlementSlug,
+			)
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument, "tailscale-connector: unknown tag entitlement %s", entitlementSlug)
+	}
+	return nil
+}
+
+func newTagBuilder(client *client.Client, devices *deviceFilter) *tagBuilder {
+	return &tagBuilder{
+		resourceType: tagResourceType,
+		client:       client,
+		devices:      devices,
+	}
+}
@@ -0,0 +1,34 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTagGrantChecksPrincipalType(t *testing.T) {
+	ctx := context.Background()
+	builder := newTagBuilder(nil, nil)
+
+	tag := &v2.Resource{Id: &v2.ResourceId{ResourceType: tagResourceType.Id, Resource: "tag:prod"}}
+	device := &v2.Resource{Id: &v2.ResourceId{ResourceType: deviceResourceType.Id, Resource: "12345"}}
+	group := &v2.Resource{Id: &v2.ResourceId{ResourceType: groupResourceType.Id, Resource: "group:eng"}}
+	ownerEntitlement := &v2.Entitlement{Resource: tag, Slug: tagOwnerEntitlement}
+	deviceEntitlement := &v2.Entitlement{Resource: tag, Slug: tagDeviceEntitlement}
+
+	_, err := builder.Grant(ctx, device, ownerEntitlement)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = builder.Grant(ctx, group, deviceEntitlement)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ownerEntitlement, Principal: device})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: deviceEntitlement, Principal: group})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -2,15 +2,38 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	configV1 "github.com/conductorone/baton-sdk/pb/c1/config/v1"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/conductorone/baton-tailscale/pkg/connutils"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+const (
+	suspendUserAction  = "suspend_user"
+	restoreUserAction  = "restore_user"
+	userIDArgument     = "user_id"
+	userStatusResponse = "status"
+
+	sharedUserType = "shared"
+	// inviteUserStatus is the status of a user created by CreateAccount, who
+	// only has a pending invite.
+	inviteUserStatus = "invite"
+)
+
+var userStatusReturnTypes = []*configV1.Field{
+	stringActionField(userIDArgument, "User ID", "The ID of the user.", true),
+	stringActionField(userStatusResponse, "Status", "The status of the user after the action, e.g. suspended.", true),
+}
+
 type userBuilder struct {
 	resourceType *v2.ResourceType
 	client       *client.Client
@@ -24,27 +47,54 @@ func userResource(ctx context.Context, user *client.User, parentResourceID *v2.R
 	userStatus := v2.UserTrait_Status_STATUS_ENABLED
 	firstName, lastName := rs.SplitFullName(user.DisplayName)
 	profile := map[string]interface{}{
-		"login":       user.LoginName,
-		"first_name":  firstName,
-		"last_name":   lastName,
-		"email":       user.LoginName,
-		"user_id":     user.ID,
-		"user_status": user.Status,
+		"login":        user.LoginName,
+		"first_name":   firstName,
+		"last_name":    lastName,
+		"email":        user.LoginName,
+		"user_id":      user.ID,
+		"user_status":  user.Status,
+		"user_type":    user.Type,
+		"role":         user.Role,
+		"device_count": int64(user.DeviceCount),
+		// Shared users belong to another tailnet and were only shared a device.
+		"is_shared": user.Type == sharedUserType,
+	}
+	if !user.Created.IsZero() {
+		profile["created"] = user.Created.Format(time.RFC3339)
+	}
+	if !user.LastSeen.IsZero() {
+		profile["last_seen"] = user.LastSeen.Format(time.RFC3339)
 	}
 
+	// https://tailscale.com/api#tag/users/GET/tailnet/{tailnet}/users
 	switch user.Status {
 	case "active":
 		userStatus = v2.UserTrait_Status_STATUS_ENABLED
+	case "idle":
+		// Idle users have not used the tailnet for a while but can still log in.
+		userStatus = v2.UserTrait_Status_STATUS_ENABLED
 	case "suspended":
 		userStatus = v2.UserTrait_Status_STATUS_DISABLED
+	case "needs-approval":
+		// Users awaiting approval cannot connect until an admin approves them.
+		userStatus = v2.UserTrait_Status_STATUS_DISABLED
+	case inviteUserStatus:
+		// Invited users have no account until they accept the invite.
+		userStatus = v2.UserTrait_Status_STATUS_UNSPECIFIED
 	}
 
 	userTraits := []rs.UserTraitOption{
 		rs.WithUserProfile(profile),
-		rs.WithStatus(userStatus),
+		rs.WithDetailedStatus(userStatus, user.Status),
 		rs.WithUserLogin(user.LoginName),
 		rs.WithEmail(user.LoginName, true),
 	}
+	if !user.Created.IsZero() {
+		userTraits = append(userTraits, rs.WithCreatedAt(user.Created))
+	}
+	if !user.LastSeen.IsZero() {
+		userTraits = append(userTraits, rs.WithLastLogin(user.LastSeen))
+	}
 
 	displayName := user.DisplayName
 	if displayName == "" {
@@ -64,93 +114,226 @@ func userResource(ctx context.Context, user *client.User, parentResourceID *v2.R
 	return ret, nil
 }
 
-// List always returns an empty slice, we don't sync users.
+// List returns all users of the tailnet. Pending invites are synced by the
+// invite builder.
 func (u *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var (
-		rv            []*v2.Resource
-		nextPageToken string
-	)
-	_, bag, err := unmarshalSkipToken(pToken)
+	var rv []*v2.Resource
+	users, ratelimitData, err := u.client.GetUsers(ctx)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, "", outputAnnotations, err
 	}
 
-	if bag.Current() == nil {
-		bag.Push(pagination.PageState{
-			ResourceTypeID: userResourceType.Id,
-		})
-		bag.Push(pagination.PageState{
-			ResourceTypeID: inviteResourceType.Id,
-		})
-	}
-
-	switch bag.ResourceTypeID() {
-	case userResourceType.Id:
-		users, _, err := u.client.GetUsers(ctx)
+	for _, user := range users {
+		usrCopy := user
+		ur, err := userResource(ctx, &usrCopy, parentResourceID)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, "", outputAnnotations, err
 		}
 
-		err = bag.Next(nextPageToken)
-		if err != nil {
-			return nil, "", nil, err
-		}
+		rv = append(rv, ur)
+	}
 
-		for _, user := range users {
-			usrCopy := user
-			ur, err := userResource(ctx, &usrCopy, parentResourceID)
-			if err != nil {
-				return nil, "", nil, err
-			}
+	return rv, "", outputAnnotations, nil
+}
 
-			rv = append(rv, ur)
-		}
-	case inviteResourceType.Id:
-		userInvites, _, err := u.client.GetUserInvites(ctx)
-		if err != nil {
-			return nil, "", nil, err
-		}
+// Entitlements always returns an empty slice for users.
+func (u *userBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
 
-		err = bag.Next(nextPageToken)
-		if err != nil {
-			return nil, "", nil, err
-		}
+// Grants always returns an empty slice for users since they don't have any entitlements.
+func (u *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
 
-		for _, user := range userInvites {
-			ur, err := userResource(ctx, &client.User{
-				ID:          user.ID,
-				DisplayName: user.Email,
-				LoginName:   user.Email,
-				Role:        user.Role,
-				Status:      "invited",
-			}, parentResourceID)
-			if err != nil {
-				return nil, "", nil, err
-			}
-
-			rv = append(rv, ur)
-		}
+// CreateAccount invites the user to the tailnet. The account only exists
+// once the invite is accepted, so the invite is returned as a user with the
+// invite status.
+func (u *userBuilder) CreateAccount(
+	ctx context.Context,
+	accountInfo *v2.AccountInfo,
+	_ *v2.CredentialOptions,
+) (
+	connectorbuilder.CreateAccountResponse,
+	[]*v2.PlaintextData,
+	annotations.Annotations,
+	error,
+) {
+	email := accountEmail(accountInfo)
+	if email == "" {
+		return nil, nil, nil, errors.New("tailscale-connector: an email is required to invite a user")
+	}
+
+	role, ok := rs.GetProfileStringValue(accountInfo.GetProfile(), "role")
+	if !ok || role == "" {
+		role = defaultRole
+	}
+	err := validateAssignableRole(role)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	default:
-		return nil, "", nil, fmt.Errorf("tailscale-connector: invalid resource type: %s", bag.ResourceTypeID())
+	userInvite, ratelimitData, err := u.client.CreateUserInvite(ctx, email, role)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	var dryRunErr *client.DryRunError
+	if errors.As(err, &dryRunErr) {
+		return dryRunAccountResponse(email, dryRunErr.Request, outputAnnotations)
+	}
+	if err != nil {
+		return nil, nil, outputAnnotations, fmt.Errorf("tailscale-connector: failed to invite user: %w", err)
 	}
 
-	nextPageToken, err = bag.Marshal()
+	resource, err := invitedUserResource(ctx, userInvite)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, outputAnnotations, err
 	}
 
-	return rv, nextPageToken, nil, nil
+	return &v2.CreateAccountResponse_SuccessResult{
+		Resource:              resource,
+		IsCreateAccountResult: true,
+	}, nil, outputAnnotations, nil
 }
 
-// Entitlements always returns an empty slice for users.
-func (u *userBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+// invitedUserResource returns the user an invite was sent to. It is
+// identified by the invite until the invite is accepted.
+func invitedUserResource(ctx context.Context, userInvite *client.UserInvite) (*v2.Resource, error) {
+	return userResource(ctx, &client.User{
+		ID:        userInvite.ID,
+		LoginName: userInvite.Email,
+		Role:      userInvite.Role,
+		Status:    inviteUserStatus,
+	}, nil)
 }
 
-// Grants always returns an empty slice for users since they don't have any entitlements.
-func (u *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+// dryRunAccountResponse reports the invite that would have been sent in
+// dry-run mode. No account exists, so no resource is returned; the request
+// is returned under `dry_run_request` in the annotations instead.
+func dryRunAccountResponse(
+	email string,
+	request *client.DryRunRequest,
+	outputAnnotations annotations.Annotations,
+) (
+	connectorbuilder.CreateAccountResponse,
+	[]*v2.PlaintextData,
+	annotations.Annotations,
+	error,
+) {
+	requestStruct, err := jsonStruct(map[string]interface{}{"dry_run_request": request})
+	if err != nil {
+		return nil, nil, outputAnnotations, err
+	}
+	outputAnnotations.Append(requestStruct)
+
+	return &v2.CreateAccountResponse_ActionRequiredResult{
+		Message: fmt.Sprintf("dry run: the invite for %s was not sent", email),
+	}, nil, outputAnnotations, nil
+}
+
+// CreateAccountCapabilityDetails advertises that invited users sign in with
+// their own identity provider, so no password is ever set.
+func (u *userBuilder) CreateAccountCapabilityDetails(
+	_ context.Context,
+) (*v2.CredentialDetailsAccountProvisioning, annotations.Annotations, error) {
+	return &v2.CredentialDetailsAccountProvisioning{
+		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
+		},
+		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
+	}, nil, nil
+}
+
+// Delete removes the user, and the devices they own, from the tailnet.
+func (u *userBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	ratelimitData, err := u.client.DeleteUser(ctx, resourceId.Resource)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return outputAnnotations, fmt.Errorf("tailscale-connector: failed to delete user: %w", err)
+	}
+
+	return outputAnnotations, nil
+}
+
+func (u *userBuilder) registerActions(manager *actionManager) {
+	manager.register(&v2.BatonActionSchema{
+		Name:        suspendUserAction,
+		DisplayName: "Suspend User",
+		Description: "Suspends a user, who can then no longer use the tailnet.",
+		Arguments: []*configV1.Field{
+			stringActionField(userIDArgument, "User ID", "The ID of the user to suspend.", true),
+		},
+		ReturnTypes: userStatusReturnTypes,
+	}, u.suspendUser)
+
+	manager.register(&v2.BatonActionSchema{
+		Name:        restoreUserAction,
+		DisplayName: "Restore User",
+		Description: "Restores a suspended user.",
+		Arguments: []*configV1.Field{
+			stringActionField(userIDArgument, "User ID", "The ID of the user to restore.", true),
+		},
+		ReturnTypes: userStatusReturnTypes,
+	}, u.restoreUser)
+}
+
+func (u *userBuilder) suspendUser(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	return u.changeUserStatus(ctx, args, u.client.SuspendUser)
+}
+
+func (u *userBuilder) restoreUser(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	return u.changeUserStatus(ctx, args, u.client.RestoreUser)
+}
+
+// changeUserStatus runs a user status change and returns the status the
+// user has afterwards, as reported by Tailscale. In dry-run mode, it is the
+// status the change would have left the user with.
+func (u *userBuilder) changeUserStatus(
+	ctx context.Context,
+	args *structpb.Struct,
+	change func(ctx context.Context, userID string) (*client.User, *v2.RateLimitDescription, error),
+) (*structpb.Struct, annotations.Annotations, error) {
+	userID, err := stringActionArgument(args, userIDArgument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, ratelimitData, err := change(ctx, userID)
+	outputAnnotations := connutils.WithRatelimitAnnotations(ratelimitData)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	response, err := structpb.NewStruct(map[string]interface{}{
+		userIDArgument:     user.ID,
+		userStatusResponse: user.Status,
+	})
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	return response, outputAnnotations, nil
+}
+
+// accountEmail returns the email to invite, from the profile, the account
+// emails or the login, in that order.
+func accountEmail(accountInfo *v2.AccountInfo) string {
+	if email, ok := rs.GetProfileStringValue(accountInfo.GetProfile(), "email"); ok && email != "" {
+		return email
+	}
+
+	for _, email := range accountInfo.GetEmails() {
+		if email.GetIsPrimary() {
+			return email.GetAddress()
+		}
+	}
+	if len(accountInfo.GetEmails()) > 0 {
+		return accountInfo.GetEmails()[0].GetAddress()
+	}
+
+	if connutils.IsValidEmail(accountInfo.GetLogin()) {
+		return accountInfo.GetLogin()
+	}
+	return ""
 }
 
 func newUserBuilder(client *client.Client) *userBuilder {
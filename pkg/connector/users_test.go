@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-tailscale/pkg/connector/client"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestUserResource(t *testing.T) {
+	ctx := context.Background()
+	lastSeen := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for status, expected := range map[string]v2.UserTrait_Status_Status{
+		"active":         v2.UserTrait_Status_STATUS_ENABLED,
+		"idle":           v2.UserTrait_Status_STATUS_ENABLED,
+		"suspended":      v2.UserTrait_Status_STATUS_DISABLED,
+		"needs-approval": v2.UserTrait_Status_STATUS_DISABLED,
+	} {
+		resource, err := userResource(ctx, &client.User{
+			ID:          "u1",
+			LoginName:   "user@example.com",
+			Type:        "shared",
+			Role:        "member",
+			Status:      status,
+			DeviceCount: 3,
+			LastSeen:    lastSeen,
+		}, nil)
+		require.Nil(t, err)
+
+		userTrait := &v2.UserTrait{}
+		resourceAnnotations := annotations.Annotations(resource.Annotations)
+		ok, err := resourceAnnotations.Pick(userTrait)
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, expected, userTrait.Status.Status, status)
+		require.Equal(t, status, userTrait.Status.Details)
+		require.Equal(t, lastSeen, userTrait.LastLogin.AsTime())
+
+		profile := userTrait.Profile.AsMap()
+		require.Equal(t, true, profile["is_shared"])
+		require.Equal(t, "member", profile["role"])
+		require.Equal(t, float64(3), profile["device_count"])
+	}
+}
+
+func TestInvitedUserResource(t *testing.T) {
+	resource, err := invitedUserResource(context.Background(), &client.UserInvite{
+		ID:    "i1",
+		Email: "new.hire@example.com",
+		Role:  "member",
+	})
+	require.Nil(t, err)
+	require.Equal(t, userResourceType.Id, resource.Id.ResourceType)
+	require.Equal(t, "i1", resource.Id.Resource)
+
+	userTrait := &v2.UserTrait{}
+	resourceAnnotations := annotations.Annotations(resource.Annotations)
+	ok, err := resourceAnnotations.Pick(userTrait)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, v2.UserTrait_Status_STATUS_UNSPECIFIED, userTrait.Status.Status)
+	require.Equal(t, "invite", userTrait.Status.Details)
+	require.Equal(t, "new.hire@example.com", userTrait.Login)
+}
+
+func TestDryRunAccountResponse(t *testing.T) {
+	request := &client.DryRunRequest{
+		Method: "POST",
+		URL:    "https://api.tailscale.com/api/v2/tailnet/example.com/user-invites",
+		Body:   []byte(`[{"email":"new@example.com","role":"member"}]`),
+	}
+
+	response, _, outputAnnotations, err := dryRunAccountResponse("new@example.com", request, nil)
+	require.Nil(t, err)
+
+	// No invite exists, so no account resource is reported.
+	actionRequired, ok := response.(*v2.CreateAccountResponse_ActionRequiredResult)
+	require.True(t, ok)
+	require.Nil(t, actionRequired.Resource)
+	require.False(t, actionRequired.IsCreateAccountResult)
+
+	requestStruct := &structpb.Struct{}
+	ok, err = outputAnnotations.Pick(requestStruct)
+	require.Nil(t, err)
+	require.True(t, ok)
+	dryRunRequest := requestStruct.GetFields()["dry_run_request"].GetStructValue()
+	require.Equal(t, request.URL, dryRunRequest.GetFields()["url"].GetStringValue())
+	body := dryRunRequest.GetFields()["body"].GetListValue().GetValues()
+	require.Equal(t, "new@example.com", body[0].GetStructValue().GetFields()["email"].GetStringValue())
+}
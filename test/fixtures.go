@@ -132,3 +132,93 @@ const ExpectedSSHResult = `// Example/default ACLs for unrestricted connections.
 	],
 }
 `
+
+const MinimalGrantsExample = `// Example/default ACLs for unrestricted connections.
+{
+	"grants": [
+		// Let developers reach production web servers.
+		{
+			"src": ["group:devs", "john.degner@insulator.one"],
+			"dst": ["tag:prod"],
+			"ip":  ["tcp:443"],
+		},
+		{
+			"src": ["logan.saso@insulator.one"],
+			"dst": ["tag:k8s-operator"],
+			"app": {
+				"tailscale.com/cap/kubernetes": [{"impersonate": {"groups": ["system:masters"]}}],
+			},
+		},
+	],
+}
+`
+
+const ExpectedGrantsResult = `// Example/default ACLs for unrestricted connections.
+{
+	"grants": [
+		// Let developers reach production web servers.
+		{
+			"src": ["group:devs", "john.degner@insulator.one", "bonk.flambe@insulator.one"],
+			"dst": ["tag:prod"],
+			"ip":  ["tcp:443"],
+		},
+		{
+			"src": ["logan.saso@insulator.one"],
+			"dst": ["tag:k8s-operator"],
+			"app": {
+				"tailscale.com/cap/kubernetes": [{"impersonate": {"groups": ["system:masters"]}}],
+			},
+		},
+	],
+}
+`
+
+const MinimalTagOwnersExample = `// Example/default ACLs for unrestricted connections.
+{
+	// Define the tags which can be applied to devices and by which users.
+	"tagOwners": {
+		"tag:prod": ["group:devs", "john.degner@insulator.one"],
+		"tag:ci":   ["autogroup:admin"],
+	},
+}
+`
+
+const ExpectedTagOwnersResult = `// Example/default ACLs for unrestricted connections.
+{
+	// Define the tags which can be applied to devices and by which users.
+	"tagOwners": {
+		"tag:prod": ["group:devs", "john.degner@insulator.one", "bonk.flambe@insulator.one"],
+		"tag:ci":   ["autogroup:admin"],
+	},
+}
+`
+
+const DuplicateGrantsExample = `{
+	"grants": [
+		{
+			"src": ["group:eng"],
+			"dst": ["tag:prod"],
+			"ip":  ["tcp:443"],
+		},
+		{
+			"src": ["group:ops"],
+			"dst": ["tag:prod"],
+			"ip":  ["tcp:443"],
+		},
+		{
+			"src": ["group:eng"],
+			"dst": ["tag:k8s-operator"],
+			"app": {
+				"tailscale.com/cap/kubernetes": [{"impersonate": {"groups": ["system:masters"]}}],
+			},
+		},
+		{
+			"src": ["group:ops"],
+			"dst": ["tag:k8s-operator"],
+			"app": {
+				"tailscale.com/cap/kubernetes": [{"impersonate": {"groups": ["viewers"]}}],
+			},
+		},
+	],
+}
+`